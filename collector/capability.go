@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstream-exporter/util"
+	"go.uber.org/zap"
+)
+
+const (
+	// probeTimeout is the deadline of probing the capabilities of a target
+	probeTimeout = 30 * time.Second
+	// capabilityTTL is how long the capabilities of a target are used before it's probed again,
+	// the server may be upgraded in place
+	capabilityTTL = 10 * time.Minute
+)
+
+// targetCapabilities are the capabilities of a target and when they are probed.
+type targetCapabilities struct {
+	capabilities *scraper.Capabilities
+	probed       time.Time
+}
+
+// probeTargets probes the capabilities of the targets in background, the targets probed
+// in capabilityTTL or being probed are skipped.
+func (h *HStreamCollector) probeTargets(targets []string) {
+	for _, target := range targets {
+		h.capabilityLock.Lock()
+		c, ok := h.capabilities[target]
+		_, probing := h.probing[target]
+		if probing || ok && time.Since(c.probed) < capabilityTTL {
+			h.capabilityLock.Unlock()
+			continue
+		}
+		h.probing[target] = struct{}{}
+		h.capabilityLock.Unlock()
+
+		go h.probe(target)
+	}
+}
+
+func (h *HStreamCollector) probe(target string) {
+	defer func() {
+		h.capabilityLock.Lock()
+		delete(h.probing, target)
+		h.capabilityLock.Unlock()
+	}()
+	if !h.enter() {
+		return
+	}
+	defer h.running.Done()
+
+	ctx, cancel := context.WithTimeout(h.ctx, probeTimeout)
+	defer cancel()
+	_, s := h.getClient()
+	capabilities, err := s.Probe(ctx, target, h.getScrapeGroups(nil))
+	if err != nil {
+		util.Logger().Warn("probe target error, retry at the next discovery", zap.String("cluster", h.cluster),
+			zap.String("target", target), zap.Error(err))
+		return
+	}
+	util.Logger().Info("probe target done", zap.String("cluster", h.cluster), zap.String("target", target),
+		zap.Strings("unsupported", capabilities.Unsupported))
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	// the target may be removed while it's probed
+	for _, u := range h.TargetUrls {
+		if u == target {
+			h.capabilityLock.Lock()
+			h.capabilities[target] = targetCapabilities{capabilities: capabilities, probed: time.Now()}
+			h.capabilityLock.Unlock()
+			return
+		}
+	}
+}
+
+// targetCapabilities returns the capabilities of the target, it's nil if the target is not probed yet.
+func (h *HStreamCollector) targetCapabilities(target string) *scraper.Capabilities {
+	h.capabilityLock.Lock()
+	defer h.capabilityLock.Unlock()
+	return h.capabilities[target].capabilities
+}
+
+// removeCapabilities drops the capabilities of the targets which are removed from the cluster.
+func (h *HStreamCollector) removeCapabilities(targets []string) {
+	h.capabilityLock.Lock()
+	defer h.capabilityLock.Unlock()
+	for _, target := range targets {
+		delete(h.capabilities, target)
+	}
+}
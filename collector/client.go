@@ -0,0 +1,181 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const defaultScheme = "hstream"
+
+var errFailoverInProgress = errors.New("failover is in progress")
+
+// parseSeeds splits the comma-separated server url into one url per server,
+// e.g. hstream://a:6570,b:6570 returns [hstream://a:6570 hstream://b:6570].
+func parseSeeds(serverUrl string) []string {
+	scheme := defaultScheme
+	if idx := strings.Index(serverUrl, "://"); idx != -1 {
+		scheme = serverUrl[:idx]
+	}
+	seeds := []string{}
+	for _, host := range strings.Split(serverUrl, ",") {
+		if host = strings.TrimSpace(host); len(host) == 0 {
+			continue
+		}
+		if !strings.Contains(host, "://") {
+			host = scheme + "://" + host
+		}
+		seeds = append(seeds, host)
+	}
+	return seeds
+}
+
+// seedTargets returns the servers in the url, which are scraped until the
+// server info is got from the cluster.
+func seedTargets(serverUrl string) []string {
+	targets := []string{}
+	for _, seed := range parseSeeds(serverUrl) {
+		targets = append(targets, hostOf(seed))
+	}
+	return targets
+}
+
+// hostOf returns the host:port of the server url, which is the server_host of the metrics.
+func hostOf(url string) string {
+	if idx := strings.Index(url, "://"); idx != -1 {
+		return url[idx+3:]
+	}
+	return url
+}
+
+func newClient(serverUrl string, opts Options) (*hstream.HStreamClient, error) {
+	authOpts := []hstream.AuthOpts{}
+	if len(opts.Token) != 0 {
+		authOpts = append(authOpts, hstream.WithAuthToken(opts.Token))
+	}
+	if len(opts.CaPath) != 0 {
+		authOpts = append(authOpts, hstream.WithCaCert(opts.CaPath))
+	}
+
+	client, err := hstream.NewHStreamClient(serverUrl, authOpts...)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Create HStream client error")
+	}
+	client.SetLogLevel(zap.WarnLevel)
+	return client, nil
+}
+
+// connect creates a client with the first seed which returns the server info. If
+// none of the seeds is reachable, the client of the first valid seed is returned
+// with the error of getting server info.
+func connect(seeds []string, opts Options) (*hstream.HStreamClient, string, []string, error) {
+	var (
+		fallback    *hstream.HStreamClient
+		fallbackUrl string
+		lastErr     error
+	)
+	for _, seed := range seeds {
+		client, err := newClient(seed, opts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		urls, err := client.GetServerInfo(false)
+		if err == nil {
+			if fallback != nil {
+				fallback.Close()
+			}
+			return client, seed, urls, nil
+		}
+
+		util.Logger().Warn("Get server info from seed error", zap.String("cluster", opts.Cluster),
+			zap.String("seed", seed), zap.Error(err))
+		lastErr = err
+		if fallback == nil {
+			fallback, fallbackUrl = client, seed
+		} else {
+			client.Close()
+		}
+	}
+	if fallback == nil {
+		if lastErr == nil {
+			lastErr = errors.New("no server in the url")
+		}
+		return nil, "", nil, lastErr
+	}
+	return fallback, fallbackUrl, nil, lastErr
+}
+
+// getClient returns the client and scraper connected to the current server.
+func (h *HStreamCollector) getClient() (*hstream.HStreamClient, scraper.Scrape) {
+	h.clientLock.RLock()
+	defer h.clientLock.RUnlock()
+	return h.client, h.scraper
+}
+
+// failoverCandidates returns the seeds and the discovered servers except the current one.
+func (h *HStreamCollector) failoverCandidates() []string {
+	h.clientLock.RLock()
+	current := h.clientUrl
+	h.clientLock.RUnlock()
+	// the last known servers are used as fallback seeds
+	h.lock.RLock()
+	known := make([]string, 0, len(h.TargetUrls))
+	for _, u := range h.TargetUrls {
+		known = append(known, h.scheme+"://"+u)
+	}
+	h.lock.RUnlock()
+
+	seen := map[string]struct{}{current: {}}
+	candidates := []string{}
+	for _, u := range append(append([]string{}, h.seeds...), known...) {
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		seen[u] = struct{}{}
+		candidates = append(candidates, u)
+	}
+	return candidates
+}
+
+// failover rebuilds the client against another live server when the current one
+// stops answering, it returns the server info got from the new server. Only one
+// failover runs at the same time, the concurrent calls return an error directly.
+func (h *HStreamCollector) failover() ([]string, error) {
+	if !h.failoverLock.TryLock() {
+		return nil, errFailoverInProgress
+	}
+	defer h.failoverLock.Unlock()
+
+	candidates := h.failoverCandidates()
+	if len(candidates) == 0 {
+		return nil, errors.New("no other server to failover")
+	}
+	client, url, urls, err := connect(candidates, h.opts)
+	if err != nil {
+		if client != nil {
+			client.Close()
+		}
+		return nil, errors.WithMessage(err, "failover error")
+	}
+	if h.ctx.Err() != nil {
+		// the collector is closed during the failover
+		client.Close()
+		return nil, h.ctx.Err()
+	}
+
+	h.clientLock.Lock()
+	previous := h.client
+	h.client, h.clientUrl, h.scraper = client, url, scraper.NewScraper(client, h.limiter)
+	h.clientLock.Unlock()
+	util.Logger().Info("Failover to another server", zap.String("cluster", h.cluster),
+		zap.String("url", url), zap.String("urls", fmt.Sprintf("%v", urls)))
+	// the in-flight requests of the previous client are failing since the server stops answering
+	previous.Close()
+	return urls, nil
+}
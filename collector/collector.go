@@ -1,219 +1,569 @@
 package collector
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
+	"github.com/hstreamdb/hstream-exporter/registry"
 	"github.com/hstreamdb/hstream-exporter/scraper"
 	"github.com/hstreamdb/hstream-exporter/util"
 	"github.com/hstreamdb/hstreamdb-go/hstream"
-	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
 const (
 	namespace = "hstream_exporter"
+	// minRetryInterval is the first interval to retry getting server info after a failure,
+	// the interval doubles on each failure until it reaches the server update duration.
+	minRetryInterval = time.Second
 )
 
-var (
-	scrapeSuccessDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "scrape", "success_scrape_count"),
-		"hstream_exporter: Number of times the target state was successfully scraped",
-		[]string{"collector"},
-		nil,
-	)
-	scrapeFailedDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "scrape", "failed_scrape_count"),
-		"hstream_exporter: Number of times the target state was failed scraped",
-		[]string{"server_host"},
-		nil,
-	)
-	scrapeLatencyDesc = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "hstream_exporter_scrape_latency",
-			Help:    "Histogram for per scrape latency.",
-			Buckets: prometheus.LinearBuckets(0, 10, 10),
-		},
-		[]string{"server_host"},
-	)
+const clusterLabel = "cluster"
 
-	totalSuccessedScrap = atomic.Uint64{}
-	totalFailedScrap    = atomic.Uint64{}
-)
+// Options holds the settings used to create a HStreamCollector.
+type Options struct {
+	ServerUrl string
+	CaPath    string
+	Token     string
+	// ServerInfoDuration is the interval between two server info updates.
+	ServerInfoDuration time.Duration
+	// Cluster is added as the cluster label of all the metrics if it's not empty.
+	Cluster string
+	// Collectors enables or disables the collectors by name, the collectors which
+	// are not in the map are enabled unless they are disabled by default.
+	Collectors map[string]bool
+	// PollInterval enables the background polling if it's positive, then Collect
+	// serves the snapshot got by the last poll instead of scraping the targets.
+	PollInterval time.Duration
+	// Summaries are the quantiles and the intervals of the summary stats by summary name,
+	// e.g. stream_append_latency. The defaults of the scraper are used for the others.
+	Summaries map[string]SummaryOptions
+	// LatencyType decides whether the latency stats are exported as summaries or histograms.
+	LatencyType scraper.LatencyType
+	// ScrapeTimeout is the deadline of the scrapes whose context has no deadline, e.g.
+	// the polls and the Collect calls. 0 means no deadline.
+	ScrapeTimeout time.Duration
+	// Metrics are the definitions of the scraped metrics, the builtin ones are used if it's nil.
+	Metrics []registry.Definition
+	// MaxRequest is the maximum number of the parallel scrape requests, which sizes the limit of
+	// the running calls of the cluster. The default limit is used if it's not positive.
+	MaxRequest int
+}
+
+func (o Options) constLabels() prometheus.Labels {
+	if len(o.Cluster) == 0 {
+		return nil
+	}
+	return prometheus.Labels{clusterLabel: o.Cluster}
+}
 
 // HStreamCollector implements the prometheus.Collector interface
 type HStreamCollector struct {
-	StreamMetrics         *StreamMetrics
-	SubMetrics            *SubscriptionMetrics
-	ConnMetrics           *ConnectorMetrics
-	QueryMetrics          *QueryMetrics
-	ViewMetrics           *ViewMetrics
-	CacheStoreMetrics     *CacheStoreMetrics
-	HealthyCheckerMetrics *HealthyCheckerMetrics
-	scraper               scraper.Scrape
-	serverUpdateDuration  time.Duration
-
-	client *hstream.HStreamClient
+	// groups are the metrics of all the collectors
+	groups         []scraper.Group
+	metaCollectors []metaCollector
+	scraper        scraper.Scrape
+	// limiter bounds the calls of the clients of the cluster, it's kept when the client is replaced
+	limiter              *scraper.Limiter
+	serverUpdateDuration time.Duration
+	cluster              string
+
+	scrapeSuccessDesc    *prometheus.Desc
+	scrapeFailedDesc     *prometheus.Desc
+	scrapeLatency        *prometheus.HistogramVec
+	scrapeErrors         *prometheus.CounterVec
+	scrapeDurationDesc   *prometheus.Desc
+	targetUpDesc         *prometheus.Desc
+	upDesc               *prometheus.Desc
+	clusterReachableDesc *prometheus.Desc
+	snapshotAgeDesc      *prometheus.Desc
+	scrapePartialDesc    *prometheus.Desc
+	discoveredDesc       *prometheus.Desc
+	lastDiscoveryDesc    *prometheus.Desc
+	discoveryErrors      prometheus.Counter
+	unsupportedStatDesc  *prometheus.Desc
+
+	opts   Options
+	seeds  []string
+	scheme string
+	// failoverLock ensures only one failover runs at the same time
+	failoverLock sync.Mutex
+	// The following fields are protected by the clientLock
+	clientLock sync.RWMutex
+	client     *hstream.HStreamClient
+	clientUrl  string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// refresh requests the discovery loop to refresh the server info
+	refresh chan struct{}
+
+	// running counts the in-flight Collect calls, it's protected by the runLock
+	runLock sync.Mutex
+	closed  bool
+	running sync.WaitGroup
 
 	// The following fields are protected by the lock
 	lock       sync.RWMutex
 	TargetUrls []string
-}
-
-func (h *HStreamCollector) getServerInfo() {
-	ticker := time.NewTicker(h.serverUpdateDuration)
-	defer func() {
-		util.Logger().Info("exit get server info loop.")
-		ticker.Stop()
-	}()
 
-	util.Logger().Info("start get server info loop.", zap.String("duration", h.serverUpdateDuration.String()))
+	// The following fields are protected by the pollLock
+	pollLock sync.Mutex
+	snapshot *snapshot
+	pollCall *pollCall
 
-	for range ticker.C {
-		urls, err := h.client.GetServerInfo(false)
-		if err != nil {
-			util.Logger().Error("get server info return error", zap.String("error", err.Error()))
-			continue
-		}
+	// The following fields are protected by the capabilityLock
+	capabilityLock sync.Mutex
+	capabilities   map[string]targetCapabilities
+	probing        map[string]struct{}
 
-		h.lock.Lock()
-		h.TargetUrls = urls
-		util.Logger().Debug("get server info", zap.String("urls", fmt.Sprintf("%+v", urls)))
-		h.lock.Unlock()
-	}
+	// The following fields are protected by the statusLock
+	statusLock    sync.Mutex
+	lastDiscovery time.Time
+	discoveryErr  error
+	targetStatus  map[string]TargetStatus
+	scrapeCounts  map[string]scrapeCount
 }
 
-func NewHStreamCollector(serverUrl string, caPath string, token string, duration int, registry *prometheus.Registry) (*HStreamCollector, error) {
-	var (
-		client *hstream.HStreamClient
-		err    error
-	)
-
-	authOpts := []hstream.AuthOpts{}
-	if len(token) != 0 {
-		authOpts = append(authOpts, hstream.WithAuthToken(token))
+// nextDiscoveryInterval returns the interval of the next server info update, retries
+// are backed off exponentially from the previous retry interval.
+func (h *HStreamCollector) nextDiscoveryInterval(retryInterval time.Duration) time.Duration {
+	if h.reachable() {
+		return h.serverUpdateDuration
 	}
-	if len(caPath) != 0 {
-		authOpts = append(authOpts, hstream.WithCaCert(caPath))
+	if retryInterval == 0 {
+		return minRetryInterval
 	}
+	return min(retryInterval*2, h.serverUpdateDuration)
+}
 
-	client, err = hstream.NewHStreamClient(serverUrl, authOpts...)
-
-	if err != nil {
-		return nil, errors.WithMessage(err, "Create HStream client error")
+func NewHStreamCollector(opts Options) (*HStreamCollector, error) {
+	if opts.Metrics == nil {
+		opts.Metrics = registry.Builtin()
 	}
-
-	client.SetLogLevel(zap.WarnLevel)
-
-	urls, err := client.GetServerInfo(false)
+	constLabels := opts.constLabels()
+	groups, err := newGroups(opts.Metrics, constLabels)
 	if err != nil {
-		return nil, errors.WithMessage(err, "Get server info error")
+		return nil, err
 	}
 
-	util.Logger().Info("Get server urls", zap.String("urls", fmt.Sprintf("%v", urls)))
-	registry.MustRegister(scrapeLatencyDesc)
+	seeds := parseSeeds(opts.ServerUrl)
+	// the collector keeps running when the cluster is unreachable, the server info
+	// is retried in the background
+	client, clientUrl, urls, discoveryErr := connect(seeds, opts)
+	if client == nil {
+		return nil, discoveryErr
+	}
+	if discoveryErr != nil {
+		urls = seedTargets(opts.ServerUrl)
+		util.Logger().Error("Get server info error, retry in background", zap.String("cluster", opts.Cluster),
+			zap.String("urls", fmt.Sprintf("%v", urls)), zap.Error(discoveryErr))
+	} else {
+		util.Logger().Info("Get server urls", zap.String("cluster", opts.Cluster), zap.String("urls", fmt.Sprintf("%v", urls)))
+	}
+	limiter := scraper.NewLimiter(opts.MaxRequest)
 	collector := &HStreamCollector{
-		TargetUrls:            urls,
-		StreamMetrics:         NewStreamMetrics(),
-		SubMetrics:            NewSubscriptionMetrics(),
-		ConnMetrics:           NewConnectorMetrics(),
-		QueryMetrics:          NewQueryMetrics(),
-		ViewMetrics:           NewViewMetrics(),
-		CacheStoreMetrics:     NewCacheStoreMetrics(),
-		HealthyCheckerMetrics: NewHealthyCheckerMetrics(),
-		scraper:               scraper.NewScraper(client),
-		serverUpdateDuration:  time.Duration(duration) * time.Second,
-		client:                client,
-	}
-	go collector.getServerInfo()
+		TargetUrls:           urls,
+		groups:               groups,
+		metaCollectors:       newMetaCollectors(constLabels),
+		scraper:              scraper.NewScraper(client, limiter),
+		limiter:              limiter,
+		serverUpdateDuration: opts.ServerInfoDuration,
+		cluster:              opts.Cluster,
+		scrapeSuccessDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "success_scrape_count"),
+			"hstream_exporter: Number of times the target state was successfully scraped",
+			[]string{"server_host"},
+			constLabels,
+		),
+		scrapeFailedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "failed_scrape_count"),
+			"hstream_exporter: Number of times the target state was failed scraped",
+			[]string{"server_host"},
+			constLabels,
+		),
+		scrapeLatency: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        "hstream_exporter_scrape_latency",
+				Help:        "Histogram for per scrape latency.",
+				Buckets:     prometheus.LinearBuckets(0, 10, 10),
+				ConstLabels: constLabels,
+			},
+			[]string{"server_host"},
+		),
+		scrapeErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Name:        "scrape_errors_total",
+				Help:        "Number of scrape errors of the target by collector and reason.",
+				ConstLabels: constLabels,
+			},
+			[]string{"server_host", "collector", "reason"},
+		),
+		scrapeDurationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "duration_seconds"),
+			"Duration of the last scrape of the target by collector.",
+			[]string{"server_host", "collector"},
+			constLabels,
+		),
+		targetUpDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "target", "up"),
+			"Whether the last scrape of the target was successful.",
+			[]string{"server_host"},
+			constLabels,
+		),
+		upDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "", "up"),
+			"Whether the last scrape of the server was successful.",
+			[]string{"server_host"},
+			constLabels,
+		),
+		clusterReachableDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "cluster", "reachable"),
+			"Whether the last server info update of the cluster was successful.",
+			nil,
+			constLabels,
+		),
+		scrapePartialDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "partial"),
+			"Whether the last scrape of the target was cut by the deadline and returned partial results.",
+			[]string{"server_host"},
+			constLabels,
+		),
+		discoveredDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "discovered_targets"),
+			"Number of the servers discovered from the cluster.",
+			nil,
+			constLabels,
+		),
+		lastDiscoveryDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "last_discovery_timestamp_seconds"),
+			"Timestamp of the last successful server info update.",
+			nil,
+			constLabels,
+		),
+		discoveryErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "discovery_errors_total",
+			Help:        "Number of the failed server info updates.",
+			ConstLabels: constLabels,
+		}),
+		unsupportedStatDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "unsupported_stat"),
+			"The stat or histogram is not supported by the server and not scraped.",
+			[]string{"server_host", "stat"},
+			constLabels,
+		),
+		snapshotAgeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "snapshot", "age_seconds"),
+			"Age of the polled snapshot served by the scrape.",
+			nil,
+			constLabels,
+		),
+		opts:         opts,
+		seeds:        seeds,
+		scheme:       seeds[0][:strings.Index(seeds[0], "://")],
+		client:       client,
+		clientUrl:    clientUrl,
+		refresh:      make(chan struct{}, 1),
+		targetStatus: make(map[string]TargetStatus),
+		scrapeCounts: make(map[string]scrapeCount),
+		capabilities: make(map[string]targetCapabilities),
+		probing:      make(map[string]struct{}),
+	}
+	collector.applySummaryOptions()
+	collector.updateDiscoveryStatus(discoveryErr)
+	if discoveryErr != nil {
+		collector.discoveryErrors.Inc()
+	}
+	collector.ctx, collector.cancel = context.WithCancel(context.Background())
+	go collector.discoveryLoop()
+	collector.probeTargets(urls)
+	if opts.PollInterval > 0 {
+		go collector.pollLoop()
+	}
 
 	return collector, nil
 }
 
-func (h *HStreamCollector) getScrapedMetrics() []scraper.Metrics {
-	metrics := []scraper.Metrics{}
-	for _, m := range h.StreamMetrics.Metrics {
-		metrics = append(metrics, m)
-	}
-	for _, m := range h.SubMetrics.Metrics {
-		metrics = append(metrics, m)
+// Close stops the server info loop, waits for the in-flight Collect calls and
+// closes the connection with HStream server.
+func (h *HStreamCollector) Close() error {
+	return h.Shutdown(context.Background())
+}
+
+// Shutdown is like Close, but stops waiting for the in-flight Collect calls when
+// ctx is done. The metrics are no longer collected after Shutdown is called.
+func (h *HStreamCollector) Shutdown(ctx context.Context) error {
+	h.runLock.Lock()
+	if h.closed {
+		h.runLock.Unlock()
+		return nil
 	}
-	for _, m := range h.ConnMetrics.Metrics {
-		metrics = append(metrics, m)
+	h.closed = true
+	h.runLock.Unlock()
+	h.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		h.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		util.Logger().Warn("close collector before the in-flight scrapes are done", zap.String("cluster", h.cluster))
 	}
-	for _, m := range h.QueryMetrics.Metrics {
-		metrics = append(metrics, m)
+	client, _ := h.getClient()
+	return client.Close()
+}
+
+// allGroups returns the groups of all the collectors.
+func (h *HStreamCollector) allGroups() []scraper.Group {
+	return h.groups
+}
+
+// applySummaryOptions sets the latency type, the quantiles and the intervals of the summary stats.
+func (h *HStreamCollector) applySummaryOptions() {
+	for _, g := range h.allGroups() {
+		for i, m := range g.Metrics {
+			if !m.IsSummary() {
+				continue
+			}
+			g.Metrics[i].LatencyType = h.opts.LatencyType
+			summary, ok := h.opts.Summaries[m.Name]
+			if !ok {
+				continue
+			}
+			g.Metrics[i].Quantiles = summary.Quantiles
+			g.Metrics[i].Intervals = summary.Intervals
+		}
 	}
-	for _, m := range h.ViewMetrics.Metrics {
-		metrics = append(metrics, m)
+}
+
+// enabled returns whether the collector is enabled by the options or by default.
+func (h *HStreamCollector) enabled(name string) bool {
+	if enabled, ok := h.opts.Collectors[name]; ok {
+		return enabled
 	}
-	for _, m := range h.CacheStoreMetrics.Metrics {
-		metrics = append(metrics, m)
+	return EnabledByDefault(name)
+}
+
+// getScrapeGroups returns the groups of the enabled collectors, only the collectors
+// in filter are returned if it's not nil.
+func (h *HStreamCollector) getScrapeGroups(filter map[string]struct{}) []scraper.Group {
+	all := h.allGroups()
+	groups := make([]scraper.Group, 0, len(all))
+	for _, g := range all {
+		if !h.enabled(g.Name) {
+			continue
+		}
+		if _, ok := filter[g.Name]; filter != nil && !ok {
+			continue
+		}
+		groups = append(groups, g)
 	}
-	for _, m := range h.HealthyCheckerMetrics.Metrics {
-		metrics = append(metrics, m)
+	return groups
+}
+
+// requestCollector scrapes with the context of a scrape request, only the collectors
+// selected by the collect[] parameter are scraped if the filter isn't nil.
+type requestCollector struct {
+	h      *HStreamCollector
+	ctx    context.Context
+	filter map[string]struct{}
+}
+
+// ForRequest returns a prometheus.Collector which scrapes with ctx, the requests not
+// done when ctx is done are abandoned. Only the named collectors are scraped if names
+// isn't empty, the disabled collectors are not scraped even if they are named.
+func (h *HStreamCollector) ForRequest(ctx context.Context, names []string) prometheus.Collector {
+	var filter map[string]struct{}
+	if len(names) != 0 {
+		filter = make(map[string]struct{}, len(names))
+		for _, name := range names {
+			filter[name] = struct{}{}
+		}
 	}
-	return metrics
+	return &requestCollector{h: h, ctx: ctx, filter: filter}
+}
+
+// Describe implement prometheus.Collector interface
+func (r *requestCollector) Describe(ch chan<- *prometheus.Desc) {
+	r.h.Describe(ch)
+}
+
+// Collect implement prometheus.Collector interface
+func (r *requestCollector) Collect(ch chan<- prometheus.Metric) {
+	r.h.collect(r.ctx, r.filter, ch)
 }
 
 // Describe implement prometheus.Collector interface
 func (h *HStreamCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- scrapeSuccessDesc
-	ch <- scrapeFailedDesc
+	ch <- h.scrapeSuccessDesc
+	ch <- h.scrapeFailedDesc
+	ch <- h.upDesc
+	ch <- h.clusterReachableDesc
+	ch <- h.targetUpDesc
+	ch <- h.scrapeDurationDesc
+	ch <- h.scrapePartialDesc
+	ch <- h.discoveredDesc
+	ch <- h.lastDiscoveryDesc
+	ch <- h.unsupportedStatDesc
+	h.discoveryErrors.Describe(ch)
+	if h.opts.PollInterval > 0 {
+		ch <- h.snapshotAgeDesc
+	}
+	h.scrapeLatency.Describe(ch)
+	h.scrapeErrors.Describe(ch)
 }
 
 // Collect implement prometheus.Collector interface
 func (h *HStreamCollector) Collect(ch chan<- prometheus.Metric) {
+	h.collect(context.Background(), nil, ch)
+}
+
+// withScrapeTimeout returns a context with the ScrapeTimeout deadline if ctx has no deadline.
+func (h *HStreamCollector) withScrapeTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || h.opts.ScrapeTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, h.opts.ScrapeTimeout)
+}
+
+// enter marks a scrape in-flight, it returns false if the collector is closed.
+// The caller must call h.running.Done when the scrape is done.
+func (h *HStreamCollector) enter() bool {
+	h.runLock.Lock()
+	defer h.runLock.Unlock()
+	if h.closed {
+		return false
+	}
+	h.running.Add(1)
+	return true
+}
+
+func (h *HStreamCollector) collect(ctx context.Context, filter map[string]struct{}, ch chan<- prometheus.Metric) {
+	if !h.enter() {
+		return
+	}
+	defer h.running.Done()
+	ctx, cancel := h.withScrapeTimeout(ctx)
+	defer cancel()
+
+	if h.opts.PollInterval > 0 {
+		h.collectSnapshot(filter, ch)
+	} else {
+		h.scrapeCluster(ctx, h.getScrapeGroups(filter), h.getMetaCollectors(filter), ch)
+	}
+	h.scrapeLatency.Collect(ch)
+	h.scrapeErrors.Collect(ch)
+	reachable := 0.0
+	if h.reachable() {
+		reachable = 1
+	}
+	ch <- prometheus.MustNewConstMetric(h.clusterReachableDesc, prometheus.GaugeValue, reachable)
+	h.lock.RLock()
+	discovered := len(h.TargetUrls)
+	h.lock.RUnlock()
+	ch <- prometheus.MustNewConstMetric(h.discoveredDesc, prometheus.GaugeValue, float64(discovered))
+	lastDiscovery := 0.0
+	if t := h.lastDiscoveryTime(); !t.IsZero() {
+		lastDiscovery = float64(t.UnixNano()) / 1e9
+	}
+	ch <- prometheus.MustNewConstMetric(h.lastDiscoveryDesc, prometheus.GaugeValue, lastDiscovery)
+	h.discoveryErrors.Collect(ch)
+	util.Logger().Debug("=============== scrape done ======================")
+}
+
+// scrapeTargets scrapes the groups of all the targets concurrently. Nothing is scraped if there
+// is no group, e.g. only the metadata collectors are selected, and the status of the targets
+// is kept, since a scrape without any request doesn't tell whether the targets are up.
+func (h *HStreamCollector) scrapeTargets(ctx context.Context, groups []scraper.Group, ch chan<- prometheus.Metric) {
+	if len(groups) == 0 {
+		return
+	}
 	wg := sync.WaitGroup{}
-	metrics := h.getScrapedMetrics()
 	h.lock.RLock()
 	wg.Add(len(h.TargetUrls))
 	util.Logger().Debug("Start scrape targets", zap.String("urls", fmt.Sprintf("%v", h.TargetUrls)))
 	for _, u := range h.TargetUrls {
 		go func(url string) {
 			defer wg.Done()
-			h.execute(metrics, url, ch)
+			h.execute(ctx, groups, url, ch)
 		}(u)
 	}
 	h.lock.RUnlock()
 	wg.Wait()
-	util.Logger().Debug("=============== scrape done ======================")
 }
 
-func (h *HStreamCollector) execute(metrics []scraper.Metrics, target string, ch chan<- prometheus.Metric) {
+func (h *HStreamCollector) execute(ctx context.Context, groups []scraper.Group, target string, ch chan<- prometheus.Metric) {
 	start := time.Now()
-	success, faild := h.scraper.Scrape(target, metrics, ch)
+	_, s := h.getClient()
+	capabilities := h.targetCapabilities(target)
+	results := s.Scrape(ctx, target, capabilities.Adapt(groups), ch)
 	diff := time.Now().Sub(start)
+
+	var (
+		success, faild, interrupted int32
+		lastErr                     error
+		unreachable                 bool
+	)
+	for _, res := range results {
+		success += res.Success
+		faild += res.Failed
+		interrupted += res.Interrupted
+		for _, err := range res.Errors {
+			h.scrapeErrors.WithLabelValues(target, res.Group, scraper.Reason(err)).Inc()
+			unreachable = unreachable || scraper.Unreachable(err)
+			if res.Failed != 0 {
+				lastErr = err
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(h.scrapeDurationDesc, prometheus.GaugeValue, res.Duration.Seconds(), target, res.Group)
+	}
+	up := h.updateTargetStatus(target, start, success, faild, lastErr)
 	util.Logger().Debug("Scrape target done", zap.String("url", target),
 		zap.Int64("milliseconds latency", diff.Milliseconds()),
 		zap.Int32("success request", success),
 		zap.Int32("failed request", faild))
 
-	totalSuccessedScrap.Add(uint64(success))
-	totalFailedScrap.Add(uint64(faild))
-
 	// only record latency when successed
-	if success != 0 && faild == 0 {
-		scrapeLatencyDesc.WithLabelValues(target).Observe(float64(diff.Milliseconds()))
+	if up {
+		h.scrapeLatency.WithLabelValues(target).Observe(float64(diff.Milliseconds()))
 	}
 
-	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.CounterValue, float64(totalSuccessedScrap.Load()), target)
-	ch <- prometheus.MustNewConstMetric(scrapeFailedDesc, prometheus.CounterValue, float64(totalFailedScrap.Load()), target)
-
-	if faild != 0 {
-		info, err := h.client.GetServerInfo(true)
-		if err != nil {
-			util.Logger().Error("Can't get cluster server info, exit exporter", zap.String("error", err.Error()))
-			os.Exit(1)
+	totalSuccess, totalFailed := h.countScrape(target, success, faild)
+	ch <- prometheus.MustNewConstMetric(h.scrapeSuccessDesc, prometheus.CounterValue, float64(totalSuccess), target)
+	ch <- prometheus.MustNewConstMetric(h.scrapeFailedDesc, prometheus.CounterValue, float64(totalFailed), target)
+	upValue := 0.0
+	if up {
+		upValue = 1
+	}
+	ch <- prometheus.MustNewConstMetric(h.upDesc, prometheus.GaugeValue, upValue, target)
+	ch <- prometheus.MustNewConstMetric(h.targetUpDesc, prometheus.GaugeValue, upValue, target)
+	partial := 0.0
+	if interrupted != 0 {
+		partial = 1
+		util.Logger().Warn("Scrape deadline exceeded, return partial results", zap.String("url", target),
+			zap.Int32("abandoned request", interrupted))
+	}
+	ch <- prometheus.MustNewConstMetric(h.scrapePartialDesc, prometheus.GaugeValue, partial, target)
+	if capabilities != nil {
+		for _, stat := range capabilities.Unsupported {
+			ch <- prometheus.MustNewConstMetric(h.unsupportedStatDesc, prometheus.GaugeValue, 1, target, stat)
 		}
-		h.lock.Lock()
-		defer h.lock.Unlock()
-		h.TargetUrls = info
-		util.Logger().Info("Scrape target failed, update the url list", zap.String("target", target),
-			zap.String("urls", fmt.Sprintf("%v", h.TargetUrls)))
+	}
+
+	// only the requests the server didn't answer mean it may be down, the abandoned requests
+	// and the errors returned by the server, e.g. the decode errors, don't
+	if unreachable {
+		util.Logger().Info("Scrape target failed, refresh the server info", zap.String("cluster", h.cluster),
+			zap.String("target", target))
+		h.requestRefresh()
 	}
 }
@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countingScraper counts the scrapes and returns a successful result for each group.
+type countingScraper struct {
+	scrapes atomic.Int32
+}
+
+func (s *countingScraper) Scrape(_ context.Context, _ string, groups []scraper.Group, _ chan<- prometheus.Metric) []scraper.Result {
+	s.scrapes.Add(1)
+	results := make([]scraper.Result, 0, len(groups))
+	for _, g := range groups {
+		results = append(results, scraper.Result{Group: g.Name, Success: 1})
+	}
+	return results
+}
+
+func (s *countingScraper) Probe(context.Context, string, []scraper.Group) (*scraper.Capabilities, error) {
+	return nil, nil
+}
+
+// fakeMetaCollector counts the collects and sends nothing.
+type fakeMetaCollector struct {
+	collects atomic.Int32
+}
+
+func (c *fakeMetaCollector) Name() string              { return "fakeMeta" }
+func (c *fakeMetaCollector) Descs() []*prometheus.Desc { return nil }
+
+func (c *fakeMetaCollector) Collect(context.Context, *hstream.HStreamClient, *scraper.Limiter, []string, chan<- prometheus.Metric) error {
+	c.collects.Add(1)
+	return nil
+}
+
+func newTestCollector(s scraper.Scrape, metas ...metaCollector) *HStreamCollector {
+	desc := prometheus.NewDesc("test", "Test metric.", []string{"server_host", "collector"}, nil)
+	return &HStreamCollector{
+		TargetUrls:         []string{"127.0.0.1:6570", "127.0.0.1:6571"},
+		groups:             []scraper.Group{{Name: "stream"}},
+		metaCollectors:     metas,
+		scraper:            s,
+		scrapeDurationDesc: desc,
+		scrapeSuccessDesc:  prometheus.NewDesc("success", "Test metric.", []string{"server_host"}, nil),
+		scrapeFailedDesc:   prometheus.NewDesc("failed", "Test metric.", []string{"server_host"}, nil),
+		upDesc:             prometheus.NewDesc("up", "Test metric.", []string{"server_host"}, nil),
+		targetUpDesc:       prometheus.NewDesc("target_up", "Test metric.", []string{"server_host"}, nil),
+		scrapePartialDesc:  prometheus.NewDesc("partial", "Test metric.", []string{"server_host"}, nil),
+		scrapeLatency:      prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "latency", Help: "Test metric."}, []string{"server_host"}),
+		scrapeErrors:       prometheus.NewCounterVec(prometheus.CounterOpts{Name: "errors", Help: "Test metric."}, []string{"server_host", "collector", "reason"}),
+		targetStatus:       make(map[string]TargetStatus),
+		scrapeCounts:       make(map[string]scrapeCount),
+		capabilities:       make(map[string]targetCapabilities),
+		probing:            make(map[string]struct{}),
+		refresh:            make(chan struct{}, 1),
+	}
+}
+
+func TestMain(m *testing.M) {
+	if err := util.InitLogger("error"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestScrapeClusterFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   map[string]struct{}
+		scrapes  int32
+		collects int32
+	}{
+		{name: "all collectors", scrapes: 2, collects: 1},
+		{name: "meta collectors only", filter: map[string]struct{}{"fakeMeta": {}}, scrapes: 0, collects: 1},
+		{name: "scrape groups only", filter: map[string]struct{}{"stream": {}}, scrapes: 2, collects: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &countingScraper{}
+			meta := &fakeMetaCollector{}
+			h := newTestCollector(s, meta)
+			ch := make(chan prometheus.Metric, 64)
+			h.scrapeCluster(context.Background(), h.getScrapeGroups(tt.filter), h.getMetaCollectors(tt.filter), ch)
+
+			if got := s.scrapes.Load(); got != tt.scrapes {
+				t.Errorf("scrapes = %d, want %d", got, tt.scrapes)
+			}
+			if got := meta.collects.Load(); got != tt.collects {
+				t.Errorf("meta collects = %d, want %d", got, tt.collects)
+			}
+			// the targets are not marked down by a scrape without any request
+			if len(h.targetStatus) != int(tt.scrapes) {
+				t.Errorf("target status = %v, want %d targets", h.targetStatus, tt.scrapes)
+			}
+			for target, status := range h.targetStatus {
+				if !status.Up {
+					t.Errorf("target %s is down: %+v", target, status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// consumerCollector exports the consumers of each subscription.
+type consumerCollector struct {
+	consumersDesc *prometheus.Desc
+	infoDesc      *prometheus.Desc
+}
+
+func newConsumerCollector(constLabels prometheus.Labels) metaCollector {
+	return &consumerCollector{
+		consumersDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "subscription", "consumers"),
+			"Number of the consumers of the subscription.",
+			[]string{"subId"},
+			constLabels,
+		),
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "subscription", "consumer_info"),
+			"Client info of the consumer, the value is always 1.",
+			[]string{"subId", "consumer", "uri", "user_agent"},
+			constLabels,
+		),
+	}
+}
+
+func (c *consumerCollector) Name() string {
+	return "consumer"
+}
+
+func (c *consumerCollector) Descs() []*prometheus.Desc {
+	return []*prometheus.Desc{c.consumersDesc, c.infoDesc}
+}
+
+func (c *consumerCollector) Collect(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter, _ []string, ch chan<- prometheus.Metric) error {
+	subs, err := scraper.CallWithContext(ctx, limiter, client.ListSubscriptions)
+	if err != nil {
+		return errors.WithMessage(err, "list subscriptions error")
+	}
+
+	var lastErr error
+	for _, sub := range subs {
+		consumers, err := scraper.CallWithContext(ctx, limiter, func() ([]hstream.Consumer, error) {
+			return client.ListConsumers(sub.SubscriptionId)
+		})
+		if err != nil {
+			lastErr = errors.WithMessage(err, fmt.Sprintf("list consumers of subscription %s error", sub.SubscriptionId))
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.consumersDesc, prometheus.GaugeValue, float64(len(consumers)), sub.SubscriptionId)
+		for _, consumer := range consumers {
+			ch <- prometheus.MustNewConstMetric(c.infoDesc, prometheus.GaugeValue, 1, sub.SubscriptionId,
+				consumer.Name, consumer.Uri, consumer.UserAgent)
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/util"
+	"go.uber.org/zap"
+)
+
+// minRefreshInterval is the minimum interval between two refreshes requested by the
+// failed scrapes, the requests in the interval are delayed and coalesced.
+const minRefreshInterval = 5 * time.Second
+
+// requestRefresh asks the discovery loop to refresh the server info from the cluster.
+// It doesn't block, the requests are coalesced until the loop handles them.
+func (h *HStreamCollector) requestRefresh() {
+	select {
+	case h.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// discoveryLoop is the only goroutine which updates the server info. It updates the
+// server info every server update duration, or when a refresh is requested. The
+// requested refreshes are rate limited by minRefreshInterval.
+func (h *HStreamCollector) discoveryLoop() {
+	timer := time.NewTimer(h.nextDiscoveryInterval(0))
+	defer func() {
+		util.Logger().Info("exit get server info loop.", zap.String("cluster", h.cluster))
+		timer.Stop()
+	}()
+
+	util.Logger().Info("start get server info loop.", zap.String("cluster", h.cluster),
+		zap.String("duration", h.serverUpdateDuration.String()))
+
+	var (
+		retryInterval time.Duration
+		lastRefresh   time.Time
+		// delayed is not nil when a rate limited refresh is waiting
+		delayed <-chan time.Time
+	)
+	for {
+		force := false
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-timer.C:
+		case <-h.refresh:
+			if delayed != nil {
+				continue
+			}
+			if wait := time.Until(lastRefresh.Add(minRefreshInterval)); wait > 0 {
+				util.Logger().Debug("delay the refresh of server info", zap.String("cluster", h.cluster),
+					zap.String("wait", wait.String()))
+				delayed = time.After(wait)
+				continue
+			}
+			force = true
+		case <-delayed:
+			delayed = nil
+			force = true
+		}
+		if force {
+			lastRefresh = time.Now()
+		}
+
+		err := h.discover(force)
+		if err != nil {
+			retryInterval = h.nextDiscoveryInterval(retryInterval)
+			util.Logger().Error("get server info return error, keep the last known servers", zap.String("cluster", h.cluster),
+				zap.Bool("refresh", force), zap.String("retry", retryInterval.String()), zap.String("error", err.Error()))
+		} else {
+			retryInterval = 0
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if err != nil {
+			timer.Reset(retryInterval)
+		} else {
+			timer.Reset(h.serverUpdateDuration)
+		}
+	}
+}
+
+// discover gets the server info from the cluster, it fails over to another server if the
+// current one doesn't answer. force requests the server to refresh the cluster members.
+func (h *HStreamCollector) discover(force bool) error {
+	client, _ := h.getClient()
+	urls, err := client.GetServerInfo(force)
+	if err != nil {
+		util.Logger().Warn("get server info return error, try other servers", zap.String("cluster", h.cluster), zap.Error(err))
+		urls, err = h.failover()
+	}
+	h.updateDiscoveryStatus(err)
+	if err != nil {
+		h.discoveryErrors.Inc()
+		return err
+	}
+	h.setTargets(urls)
+	h.probeTargets(urls)
+	return nil
+}
+
+// setTargets replaces the target urls, the status of the removed targets is dropped.
+func (h *HStreamCollector) setTargets(urls []string) {
+	h.lock.Lock()
+	previous := h.TargetUrls
+	h.TargetUrls = urls
+	h.lock.Unlock()
+
+	added, removed := diffUrls(previous, urls)
+	if len(added) == 0 && len(removed) == 0 {
+		util.Logger().Debug("get server info", zap.String("cluster", h.cluster), zap.String("urls", fmt.Sprintf("%+v", urls)))
+		return
+	}
+	util.Logger().Info("server list changed", zap.String("cluster", h.cluster),
+		zap.String("added", fmt.Sprintf("%v", added)), zap.String("removed", fmt.Sprintf("%v", removed)))
+	h.removeTargetStatus(removed)
+	h.removeCapabilities(removed)
+}
+
+// diffUrls returns the urls only in current and the urls only in previous.
+func diffUrls(previous, current []string) ([]string, []string) {
+	inPrevious := make(map[string]struct{}, len(previous))
+	for _, u := range previous {
+		inPrevious[u] = struct{}{}
+	}
+	added := []string{}
+	for _, u := range current {
+		if _, ok := inPrevious[u]; ok {
+			delete(inPrevious, u)
+			continue
+		}
+		added = append(added, u)
+	}
+	removed := []string{}
+	for _, u := range previous {
+		if _, ok := inPrevious[u]; ok {
+			removed = append(removed, u)
+		}
+	}
+	return added, removed
+}
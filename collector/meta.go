@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// metaCollector collects the metadata of the cluster through the client, e.g. the streams.
+// Unlike the scraper groups, which are scraped on every server, the metadata is collected
+// once per scrape from the server the client connects to.
+type metaCollector interface {
+	// Name is the collector name used by the collector flags and the collect[] parameters.
+	Name() string
+	// Descs are the descs of the metrics sent by Collect.
+	Descs() []*prometheus.Desc
+	// Collect sends the metrics to ch, the calls of the client are bounded by limiter and
+	// abandoned when ctx is done. targets are the servers of the cluster.
+	Collect(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter, targets []string, ch chan<- prometheus.Metric) error
+}
+
+// newMetaCollectors returns all the metadata collectors.
+func newMetaCollectors(constLabels prometheus.Labels) []metaCollector {
+	return []metaCollector{
+		newStreamMetaCollector(constLabels),
+		newShardCollector(constLabels),
+		newSubscriptionLagCollector(constLabels),
+		newConsumerCollector(constLabels),
+		newQueryMetaCollector(constLabels),
+	}
+}
+
+// metaNames returns the names of the metadata collectors.
+func metaNames() []string {
+	names := []string{}
+	for _, c := range newMetaCollectors(nil) {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// getMetaCollectors returns the enabled metadata collectors, only the collectors in filter
+// are returned if it's not nil.
+func (h *HStreamCollector) getMetaCollectors(filter map[string]struct{}) []metaCollector {
+	collectors := make([]metaCollector, 0, len(h.metaCollectors))
+	for _, c := range h.metaCollectors {
+		if !h.enabled(c.Name()) {
+			continue
+		}
+		if _, ok := filter[c.Name()]; filter != nil && !ok {
+			continue
+		}
+		collectors = append(collectors, c)
+	}
+	return collectors
+}
+
+// collectMeta runs the metadata collectors concurrently.
+func (h *HStreamCollector) collectMeta(ctx context.Context, collectors []metaCollector, ch chan<- prometheus.Metric) {
+	client, _ := h.getClient()
+	h.clientLock.RLock()
+	target := hostOf(h.clientUrl)
+	h.clientLock.RUnlock()
+	h.lock.RLock()
+	targets := append([]string{}, h.TargetUrls...)
+	h.lock.RUnlock()
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(collectors))
+	for _, c := range collectors {
+		go func(c metaCollector) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.Collect(ctx, client, h.limiter, targets, ch)
+			ch <- prometheus.MustNewConstMetric(h.scrapeDurationDesc, prometheus.GaugeValue, time.Since(start).Seconds(), target, c.Name())
+			if err != nil {
+				h.scrapeErrors.WithLabelValues(target, c.Name(), scraper.Reason(err)).Inc()
+				util.Logger().Error("collect metadata error", zap.String("cluster", h.cluster),
+					zap.String("collector", c.Name()), zap.String("target", target), zap.Error(err))
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// scrapeCluster scrapes the groups of all the targets and collects the metadata concurrently.
+func (h *HStreamCollector) scrapeCluster(ctx context.Context, groups []scraper.Group, metas []metaCollector, ch chan<- prometheus.Metric) {
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.collectMeta(ctx, metas, ch)
+	}()
+	h.scrapeTargets(ctx, groups, ch)
+	wg.Wait()
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/registry"
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SummaryOptions are the quantiles and the server side intervals of a summary stat.
+type SummaryOptions struct {
+	Quantiles []float64
+	Intervals []string
+}
+
+// newGroups builds the metrics of the definitions grouped by the subsystem.
+func newGroups(defs []registry.Definition, constLabels prometheus.Labels) ([]scraper.Group, error) {
+	groups := []scraper.Group{}
+	index := make(map[string]int)
+	for _, def := range defs {
+		m := scraper.Metrics{
+			Name:         def.Key(),
+			ValueType:    def.Type,
+			Histogram:    def.Histogram,
+			LabelColumns: def.LabelColumns,
+		}
+		labels := append([]string{}, def.Labels...)
+		switch def.Source {
+		case registry.SourceStats:
+			stat, ok := scraper.Stats[def.Stat]
+			if !ok {
+				return nil, fmt.Errorf("unknown stat %q of metric %s", def.Stat, def.Key())
+			}
+			m.Stat = stat
+		case registry.SourceCommand:
+			m.Command = def.Command
+			m.ValueColumn = def.ValueColumn
+			m.MinInterval = time.Duration(def.MinInterval) * time.Second
+		default:
+			if len(def.CountStat) != 0 {
+				stat, ok := scraper.Stats[def.CountStat]
+				if !ok {
+					return nil, fmt.Errorf("unknown count stat %q of metric %s", def.CountStat, def.Key())
+				}
+				m.CountStat = stat
+			}
+		}
+		name := prometheus.BuildFQName(namespace, def.Subsystem, def.Name)
+		if m.IsSummary() {
+			m.HistogramDesc = prometheus.NewDesc(name, def.Help, append(append([]string{}, labels...), "server_host"), constLabels)
+			labels = append(labels, "interval")
+		}
+		labels = append(labels, "server_host")
+		m.Metric = prometheus.NewDesc(name, def.Help, labels, constLabels)
+
+		i, ok := index[def.Subsystem]
+		if !ok {
+			i = len(groups)
+			index[def.Subsystem] = i
+			groups = append(groups, scraper.Group{Name: def.Subsystem})
+		}
+		groups[i].Metrics = append(groups[i].Metrics, m)
+	}
+	return groups, nil
+}
+
+// CheckMetrics returns an error if any of the definitions can't be scraped.
+func CheckMetrics(defs []registry.Definition) error {
+	_, err := newGroups(defs, nil)
+	return err
+}
+
+// SummaryNames returns the names of the summary stats in the definitions.
+func SummaryNames(defs []registry.Definition) []string {
+	names := []string{}
+	for _, def := range defs {
+		if def.Type == registry.Summary {
+			names = append(names, def.Key())
+		}
+	}
+	return names
+}
+
+// CheckSummaries returns an error if any of the summary options is invalid.
+func CheckSummaries(summaries map[string]SummaryOptions, defs []registry.Definition) error {
+	valid := make(map[string]struct{})
+	for _, name := range SummaryNames(defs) {
+		valid[name] = struct{}{}
+	}
+	for name, summary := range summaries {
+		if _, ok := valid[name]; !ok {
+			return fmt.Errorf("unknown summary stat %q", name)
+		}
+		for _, q := range summary.Quantiles {
+			if q <= 0 || q >= 1 {
+				return fmt.Errorf("quantile %v of %s must be in (0, 1)", q, name)
+			}
+		}
+		for _, interval := range summary.Intervals {
+			if len(interval) == 0 {
+				return fmt.Errorf("interval of %s can't be empty", name)
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	// ShardCollector exports each shard of the streams, it's disabled by default for the cardinality.
+	ShardCollector = "shard"
+)
+
+// Names returns the names of the builtin collectors, which are used by the collector flags.
+func Names() []string {
+	return append(registry.Subsystems(registry.Builtin()), metaNames()...)
+}
+
+// EnabledByDefault returns whether the collector is enabled if it's not configured.
+func EnabledByDefault(name string) bool {
+	return name != ShardCollector
+}
+
+// CheckNames returns an error if any of the names is not a collector of the definitions.
+func CheckNames(names []string, defs []registry.Definition) error {
+	valid := make(map[string]struct{})
+	for _, name := range registry.Subsystems(defs) {
+		valid[name] = struct{}{}
+	}
+	for _, name := range metaNames() {
+		valid[name] = struct{}{}
+	}
+	for _, name := range names {
+		if _, ok := valid[name]; !ok {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// snapshot holds the metrics of all the targets got by a poll.
+type snapshot struct {
+	metrics []prometheus.Metric
+	time    time.Time
+}
+
+// pollCall is an in-flight poll, the concurrent callers wait until done is closed
+// and share its snapshot.
+type pollCall struct {
+	done chan struct{}
+	snap *snapshot
+}
+
+// pollLoop refreshes the snapshot every poll interval until the collector is closed.
+func (h *HStreamCollector) pollLoop() {
+	ticker := time.NewTicker(h.opts.PollInterval)
+	defer func() {
+		util.Logger().Info("exit poll loop.", zap.String("cluster", h.cluster))
+		ticker.Stop()
+	}()
+
+	util.Logger().Info("start poll loop.", zap.String("cluster", h.cluster),
+		zap.String("interval", h.opts.PollInterval.String()))
+	for {
+		if !h.enter() {
+			return
+		}
+		h.poll()
+		h.running.Done()
+
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll scrapes all the targets into a new snapshot. Only one poll runs at the same
+// time, the concurrent calls wait for the in-flight one and return its snapshot.
+func (h *HStreamCollector) poll() *snapshot {
+	h.pollLock.Lock()
+	if call := h.pollCall; call != nil {
+		h.pollLock.Unlock()
+		<-call.done
+		return call.snap
+	}
+	call := &pollCall{done: make(chan struct{})}
+	h.pollCall = call
+	h.pollLock.Unlock()
+
+	ctx, cancel := h.withScrapeTimeout(h.ctx)
+	defer cancel()
+	start := time.Now()
+	ch := make(chan prometheus.Metric)
+	collected := make(chan []prometheus.Metric)
+	go func() {
+		metrics := []prometheus.Metric{}
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		collected <- metrics
+	}()
+	h.scrapeCluster(ctx, h.getScrapeGroups(nil), h.getMetaCollectors(nil), ch)
+	close(ch)
+	call.snap = &snapshot{metrics: <-collected, time: time.Now()}
+	util.Logger().Debug("Poll targets done", zap.String("cluster", h.cluster),
+		zap.Int("metrics", len(call.snap.metrics)), zap.Int64("milliseconds latency", time.Since(start).Milliseconds()))
+
+	h.pollLock.Lock()
+	h.snapshot = call.snap
+	h.pollCall = nil
+	h.pollLock.Unlock()
+	close(call.done)
+	return call.snap
+}
+
+// collectSnapshot sends the metrics of the latest snapshot to ch, it waits for the
+// in-flight poll if no poll is done yet. Only the metrics of the collectors in
+// filter are sent if it's not nil.
+func (h *HStreamCollector) collectSnapshot(filter map[string]struct{}, ch chan<- prometheus.Metric) {
+	h.pollLock.Lock()
+	snap := h.snapshot
+	h.pollLock.Unlock()
+	if snap == nil {
+		snap = h.poll()
+	}
+
+	// the descs of the filtered out collectors
+	excluded := make(map[*prometheus.Desc]struct{})
+	if filter != nil {
+		for _, g := range h.getScrapeGroups(nil) {
+			if _, ok := filter[g.Name]; ok {
+				continue
+			}
+			for _, m := range g.Metrics {
+				excluded[m.Metric] = struct{}{}
+			}
+		}
+		for _, c := range h.getMetaCollectors(nil) {
+			if _, ok := filter[c.Name()]; ok {
+				continue
+			}
+			for _, desc := range c.Descs() {
+				excluded[desc] = struct{}{}
+			}
+		}
+	}
+	for _, m := range snap.metrics {
+		if _, ok := excluded[m.Desc()]; ok {
+			continue
+		}
+		ch <- m
+	}
+	ch <- prometheus.MustNewConstMetric(h.snapshotAgeDesc, prometheus.GaugeValue, time.Since(snap.time).Seconds())
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queryStatuses are the statuses of a query, every one of them is exported for each
+// query so that the alerts can match the status changes.
+var queryStatuses = []string{"created", "running", "paused", "resumed", "terminated", "aborted", "unknown"}
+
+// queryMetaCollector exports the status, the creation time and the source streams and
+// sink of each query.
+type queryMetaCollector struct {
+	statusDesc  *prometheus.Desc
+	createdDesc *prometheus.Desc
+	infoDesc    *prometheus.Desc
+}
+
+func newQueryMetaCollector(constLabels prometheus.Labels) metaCollector {
+	return &queryMetaCollector{
+		statusDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "query", "status"),
+			"Whether the query is in the status.",
+			[]string{"query_id", "status"},
+			constLabels,
+		),
+		createdDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "query", "created_timestamp_seconds"),
+			"Creation time of the query.",
+			[]string{"query_id"},
+			constLabels,
+		),
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "query", "info"),
+			"Source streams and sink of the query, the value is always 1.",
+			[]string{"query_id", "sources", "sink"},
+			constLabels,
+		),
+	}
+}
+
+func (c *queryMetaCollector) Name() string {
+	return "queryMeta"
+}
+
+func (c *queryMetaCollector) Descs() []*prometheus.Desc {
+	return []*prometheus.Desc{c.statusDesc, c.createdDesc, c.infoDesc}
+}
+
+func (c *queryMetaCollector) Collect(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter, _ []string, ch chan<- prometheus.Metric) error {
+	queries, err := scraper.CallWithContext(ctx, limiter, client.ListQueries)
+	if err != nil {
+		return errors.WithMessage(err, "list queries error")
+	}
+	for _, q := range queries {
+		status := strings.ToLower(q.Status)
+		known := false
+		for _, s := range queryStatuses {
+			value := 0.0
+			if s == status {
+				value = 1
+				known = true
+			}
+			ch <- prometheus.MustNewConstMetric(c.statusDesc, prometheus.GaugeValue, value, q.Id, s)
+		}
+		// a status added by a new server is exported too
+		if !known {
+			ch <- prometheus.MustNewConstMetric(c.statusDesc, prometheus.GaugeValue, 1, q.Id, status)
+		}
+		ch <- prometheus.MustNewConstMetric(c.createdDesc, prometheus.GaugeValue, float64(q.CreatedTime)/1e3, q.Id)
+		ch <- prometheus.MustNewConstMetric(c.infoDesc, prometheus.GaugeValue, 1, q.Id, strings.Join(q.Sources, ","), q.Sink)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// shardCollector exports the shards of all the streams with their key ranges.
+type shardCollector struct {
+	infoDesc *prometheus.Desc
+}
+
+func newShardCollector(constLabels prometheus.Labels) metaCollector {
+	return &shardCollector{
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "stream_shard", "info"),
+			"Key range of the shard, the value is always 1.",
+			[]string{"stream", "shard_id", "start_key", "end_key"},
+			constLabels,
+		),
+	}
+}
+
+func (c *shardCollector) Name() string {
+	return ShardCollector
+}
+
+func (c *shardCollector) Descs() []*prometheus.Desc {
+	return []*prometheus.Desc{c.infoDesc}
+}
+
+func (c *shardCollector) Collect(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter, _ []string, ch chan<- prometheus.Metric) error {
+	shards, err := listShards(ctx, client, limiter)
+	for _, shard := range shards {
+		ch <- prometheus.MustNewConstMetric(c.infoDesc, prometheus.GaugeValue, 1, shard.StreamName,
+			strconv.FormatUint(shard.ShardId, 10), shard.StartHashRangeKey, shard.EndHashRangeKey)
+	}
+	return err
+}
+
+// listShards returns the shards of all the streams, the shards of the streams are listed
+// concurrently. The shards listed are returned with the last error if any stream fails.
+func listShards(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter) ([]hstream.Shard, error) {
+	streams, err := scraper.CallWithContext(ctx, limiter, client.ListStreams)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list streams error")
+	}
+
+	lock := sync.Mutex{}
+	var (
+		shards  []hstream.Shard
+		lastErr error
+	)
+	wg := sync.WaitGroup{}
+	wg.Add(len(streams))
+	for _, s := range streams {
+		go func(stream string) {
+			defer wg.Done()
+			streamShards, err := scraper.CallWithContext(ctx, limiter, func() ([]hstream.Shard, error) {
+				return client.ListShards(stream)
+			})
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				lastErr = errors.WithMessage(err, fmt.Sprintf("list shards of stream %s error", stream))
+				return
+			}
+			shards = append(shards, streamShards...)
+		}(s.StreamName)
+	}
+	wg.Wait()
+	return shards, lastErr
+}
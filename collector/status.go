@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TargetStatus is the result of the last scrape of a server.
+type TargetStatus struct {
+	Target     string    `json:"target"`
+	Up         bool      `json:"up"`
+	LastScrape time.Time `json:"last_scrape"`
+	Duration   float64   `json:"duration_seconds"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Status reports the connectivity of the cluster.
+type Status struct {
+	Cluster        string         `json:"cluster,omitempty"`
+	Ready          bool           `json:"ready"`
+	LastDiscovery  time.Time      `json:"last_discovery"`
+	DiscoveryError string         `json:"discovery_error,omitempty"`
+	Targets        []TargetStatus `json:"targets"`
+}
+
+func (h *HStreamCollector) updateDiscoveryStatus(err error) {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	h.discoveryErr = err
+	if err == nil {
+		h.lastDiscovery = time.Now()
+	}
+}
+
+// lastDiscoveryTime returns the time of the last successful server info update.
+func (h *HStreamCollector) lastDiscoveryTime() time.Time {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	return h.lastDiscovery
+}
+
+// removeTargetStatus drops the status of the targets which are removed from the cluster.
+func (h *HStreamCollector) removeTargetStatus(targets []string) {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	for _, target := range targets {
+		delete(h.targetStatus, target)
+		delete(h.scrapeCounts, target)
+	}
+}
+
+// scrapeCount is the total number of the scrape requests of a target.
+type scrapeCount struct {
+	success uint64
+	failed  uint64
+}
+
+// countScrape adds the scrape requests of target and returns the total numbers.
+func (h *HStreamCollector) countScrape(target string, success, failed int32) (uint64, uint64) {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	count := h.scrapeCounts[target]
+	count.success += uint64(success)
+	count.failed += uint64(failed)
+	h.scrapeCounts[target] = count
+	return count.success, count.failed
+}
+
+// reachable returns whether the last server info update was successful.
+func (h *HStreamCollector) reachable() bool {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	return h.discoveryErr == nil
+}
+
+// updateTargetStatus records the result of the scrape and returns whether the target is up.
+func (h *HStreamCollector) updateTargetStatus(target string, start time.Time, success, failed int32, err error) bool {
+	status := TargetStatus{
+		Target:     target,
+		Up:         success != 0 && failed == 0,
+		LastScrape: start,
+		Duration:   time.Since(start).Seconds(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	} else if failed != 0 {
+		status.Error = fmt.Sprintf("%d scrape requests failed", failed)
+	}
+
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	h.targetStatus[target] = status
+	return status.Up
+}
+
+// Status returns the connectivity of the cluster. The cluster is ready when the last
+// server info update succeeded in maxDiscoveryIntervals intervals, and at least one
+// of the servers is scraped successfully in the last scrape.
+func (h *HStreamCollector) Status(maxDiscoveryIntervals int) Status {
+	h.lock.RLock()
+	targets := make([]string, len(h.TargetUrls))
+	copy(targets, h.TargetUrls)
+	h.lock.RUnlock()
+	sort.Strings(targets)
+
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	status := Status{
+		Cluster:       h.cluster,
+		LastDiscovery: h.lastDiscovery,
+		Targets:       make([]TargetStatus, 0, len(targets)),
+	}
+	if h.discoveryErr != nil {
+		status.DiscoveryError = h.discoveryErr.Error()
+	}
+
+	anyUp := false
+	for _, target := range targets {
+		ts, ok := h.targetStatus[target]
+		if !ok {
+			ts = TargetStatus{Target: target, Error: "not scraped yet"}
+		}
+		anyUp = anyUp || ts.Up
+		status.Targets = append(status.Targets, ts)
+	}
+	discovered := time.Since(h.lastDiscovery) <= time.Duration(maxDiscoveryIntervals)*h.serverUpdateDuration
+	status.Ready = discovered && anyUp
+	return status
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// streamMetaCollector exports the settings of all the streams, including the streams
+// without any traffic.
+type streamMetaCollector struct {
+	infoDesc   *prometheus.Desc
+	shardsDesc *prometheus.Desc
+	totalDesc  *prometheus.Desc
+}
+
+func newStreamMetaCollector(constLabels prometheus.Labels) metaCollector {
+	return &streamMetaCollector{
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "stream", "info"),
+			"Settings of the stream, the value is always 1.",
+			[]string{"stream", "replication_factor", "backlog_duration"},
+			constLabels,
+		),
+		shardsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "stream", "shards"),
+			"Number of the shards of the stream.",
+			[]string{"stream"},
+			constLabels,
+		),
+		totalDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "", "streams_total"),
+			"Number of the streams in the cluster.",
+			nil,
+			constLabels,
+		),
+	}
+}
+
+func (c *streamMetaCollector) Name() string {
+	return "streamMeta"
+}
+
+func (c *streamMetaCollector) Descs() []*prometheus.Desc {
+	return []*prometheus.Desc{c.infoDesc, c.shardsDesc, c.totalDesc}
+}
+
+func (c *streamMetaCollector) Collect(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter, _ []string, ch chan<- prometheus.Metric) error {
+	streams, err := scraper.CallWithContext(ctx, limiter, client.ListStreams)
+	if err != nil {
+		return errors.WithMessage(err, "list streams error")
+	}
+	for _, s := range streams {
+		ch <- prometheus.MustNewConstMetric(c.infoDesc, prometheus.GaugeValue, 1, s.StreamName,
+			strconv.FormatUint(uint64(s.ReplicationFactor), 10), strconv.FormatUint(uint64(s.BacklogDuration), 10))
+		ch <- prometheus.MustNewConstMetric(c.shardsDesc, prometheus.GaugeValue, float64(s.ShardCount), s.StreamName)
+	}
+	ch <- prometheus.MustNewConstMetric(c.totalDesc, prometheus.GaugeValue, float64(len(streams)))
+	return nil
+}
@@ -0,0 +1,248 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// appendRateInterval is the least interval between the samples of the appended records of
+	// a stream, the append rate is computed between the samples no matter how often the
+	// collector is called
+	appendRateInterval = 30 * time.Second
+	// appendRateExpiry is how long the samples of a stream not seen by the scrapes are kept
+	appendRateExpiry = 10 * time.Minute
+)
+
+// shardKey identifies a shard of a stream.
+type shardKey struct {
+	stream string
+	shard  uint64
+}
+
+// appendSample is the records appended to a stream by all the servers.
+type appendSample struct {
+	records float64
+	time    time.Time
+	// rate is the records appended per second between the last two samples
+	rate float64
+	// seen is when the stream is seen by a scrape
+	seen time.Time
+}
+
+// streamAppends are the appends of a stream counted by all the servers.
+type streamAppends struct {
+	records float64
+	batches float64
+}
+
+// subscriptionLagCollector exports how far each subscription is behind the tail of
+// every shard of its stream.
+type subscriptionLagCollector struct {
+	lagDesc     *prometheus.Desc
+	lagTimeDesc *prometheus.Desc
+
+	// The following fields are protected by the lock
+	lock sync.Mutex
+	// samples are the samples of the streams taken every appendRateInterval, which are shared
+	// by the concurrent scrapes
+	samples map[string]appendSample
+}
+
+func newSubscriptionLagCollector(constLabels prometheus.Labels) metaCollector {
+	return &subscriptionLagCollector{
+		lagDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "subscription", "lag_records"),
+			"Number of the records of the shard after the committed offset of the subscription, it's estimated if the offset is not in the tail batch.",
+			[]string{"subId", "stream", "shard_id"},
+			constLabels,
+		),
+		lagTimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("hstream", "subscription", "lag_seconds"),
+			"Estimated time to append the records not committed by the subscription, by the append rate of the stream.",
+			[]string{"subId", "stream"},
+			constLabels,
+		),
+		samples: make(map[string]appendSample),
+	}
+}
+
+func (c *subscriptionLagCollector) Name() string {
+	return "subscriptionLag"
+}
+
+func (c *subscriptionLagCollector) Descs() []*prometheus.Desc {
+	return []*prometheus.Desc{c.lagDesc, c.lagTimeDesc}
+}
+
+func (c *subscriptionLagCollector) Collect(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter, targets []string, ch chan<- prometheus.Metric) error {
+	subs, err := scraper.CallWithContext(ctx, limiter, client.ListSubscriptions)
+	if err != nil {
+		return errors.WithMessage(err, "list subscriptions error")
+	}
+	appends, rates, lastErr := c.getAppends(ctx, client, limiter, targets)
+
+	// the tails got by this scrape, they are shared by the subscriptions of the same stream
+	tails := make(map[shardKey]hstream.RecordId)
+	for _, sub := range subs {
+		offsets, err := scraper.CallWithContext(ctx, limiter, func() ([]hstream.SubscriptionOffset, error) {
+			return client.GetSubscriptionOffsets(sub.SubscriptionId)
+		})
+		if err != nil {
+			lastErr = errors.WithMessage(err, fmt.Sprintf("get offsets of subscription %s error", sub.SubscriptionId))
+			continue
+		}
+
+		var total float64
+		complete := true
+		for _, offset := range offsets {
+			key := shardKey{stream: sub.StreamName, shard: offset.ShardId}
+			tail, ok := tails[key]
+			if !ok {
+				if tail, err = getTail(ctx, client, limiter, key); err != nil {
+					lastErr = err
+					complete = false
+					continue
+				}
+				tails[key] = tail
+			}
+
+			lag, ok := lagRecords(offset, tail, appends[sub.StreamName])
+			if !ok {
+				complete = false
+				continue
+			}
+			total += lag
+			ch <- prometheus.MustNewConstMetric(c.lagDesc, prometheus.GaugeValue, lag, sub.SubscriptionId, sub.StreamName,
+				strconv.FormatUint(offset.ShardId, 10))
+		}
+
+		if !complete {
+			continue
+		}
+		if total == 0 {
+			ch <- prometheus.MustNewConstMetric(c.lagTimeDesc, prometheus.GaugeValue, 0, sub.SubscriptionId, sub.StreamName)
+		} else if rate := rates[sub.StreamName]; rate > 0 {
+			ch <- prometheus.MustNewConstMetric(c.lagTimeDesc, prometheus.GaugeValue, total/rate, sub.SubscriptionId, sub.StreamName)
+		}
+	}
+	return lastErr
+}
+
+// lagRecords returns the number of the records after the offset till the tail of the shard.
+// The batch ids are the LSNs of the store, which count the batches of a shard in the same
+// epoch, the high 32 bits. The lag is exact if the offset is in the tail batch, otherwise
+// the batches between them are taken as the average batch of the stream. It's unknown if
+// the epochs of the offset and the tail are different, or the stream has no appends.
+func lagRecords(offset hstream.SubscriptionOffset, tail hstream.RecordId, appends streamAppends) (float64, bool) {
+	if offset.BatchId > tail.BatchId || offset.BatchId == tail.BatchId && offset.BatchIndex >= tail.BatchIndex {
+		return 0, true
+	}
+	if offset.BatchId == tail.BatchId {
+		return float64(tail.BatchIndex - offset.BatchIndex), true
+	}
+	if offset.BatchId>>32 != tail.BatchId>>32 || appends.batches == 0 {
+		return 0, false
+	}
+	// the records after the offset in its batch, the batches till the tail batch, and the
+	// records of the tail batch
+	batches := float64(tail.BatchId - offset.BatchId)
+	lag := batches*appends.records/appends.batches + float64(tail.BatchIndex) - float64(offset.BatchIndex)
+	return max(lag, 0), true
+}
+
+// getAppends returns the appends of the streams counted by all the targets, and the append
+// rates of the streams. The rates are only updated if all the targets answer.
+func (c *subscriptionLagCollector) getAppends(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter,
+	targets []string) (map[string]streamAppends, map[string]float64, error) {
+	lock := sync.Mutex{}
+	appends := make(map[string]streamAppends)
+	var lastErr error
+	wg := sync.WaitGroup{}
+	wg.Add(len(targets))
+	for _, target := range targets {
+		go func(target string) {
+			defer wg.Done()
+			results, err := scraper.CallWithContext(ctx, limiter, func() ([]hstream.StatResult, error) {
+				return client.GetStatsRequest(target, []hstream.StatType{hstream.StreamAppendInRecords, hstream.StreamAppendTotal})
+			})
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				lastErr = errors.WithMessage(err, fmt.Sprintf("get append stats of %s error", target))
+				return
+			}
+			for _, res := range results {
+				switch res := res.(type) {
+				case hstream.StatValue:
+					for stream, v := range res.Value {
+						a := appends[stream]
+						if res.Type == hstream.StreamAppendInRecords {
+							a.records += float64(v)
+						} else {
+							a.batches += float64(v)
+						}
+						appends[stream] = a
+					}
+				case hstream.StatError:
+					lastErr = fmt.Errorf("%w: %s: %s", scraper.ErrStat, res.Type, res.Message)
+				}
+			}
+		}(target)
+	}
+	wg.Wait()
+	return appends, c.updateRates(appends, len(targets) != 0 && lastErr == nil), lastErr
+}
+
+// updateRates returns the append rates of the streams. The samples taken at least
+// appendRateInterval ago are replaced by the appends if they are complete.
+func (c *subscriptionLagCollector) updateRates(appends map[string]streamAppends, complete bool) map[string]float64 {
+	now := time.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	rates := make(map[string]float64, len(appends))
+	for stream, a := range appends {
+		last, ok := c.samples[stream]
+		switch {
+		case !complete:
+		case !ok:
+			last = appendSample{records: a.records, time: now}
+		case now.Sub(last.time) >= appendRateInterval:
+			// the rate is unknown if the counter goes back, e.g. a server restarts
+			last.rate = 0
+			if a.records >= last.records {
+				last.rate = (a.records - last.records) / now.Sub(last.time).Seconds()
+			}
+			last.records, last.time = a.records, now
+		}
+		last.seen = now
+		c.samples[stream] = last
+		rates[stream] = last.rate
+	}
+	// drop the streams not seen for a while, e.g. the deleted streams
+	for stream, sample := range c.samples {
+		if now.Sub(sample.seen) > appendRateExpiry {
+			delete(c.samples, stream)
+		}
+	}
+	return rates
+}
+
+// getTail returns the id of the last record of the shard.
+func getTail(ctx context.Context, client *hstream.HStreamClient, limiter *scraper.Limiter, key shardKey) (hstream.RecordId, error) {
+	id, err := scraper.CallWithContext(ctx, limiter, func() (hstream.RecordId, error) {
+		return client.GetTailRecordId(key.stream, key.shard)
+	})
+	if err != nil {
+		return id, errors.WithMessage(err, fmt.Sprintf("get tail of shard %d of stream %s error", key.shard, key.stream))
+	}
+	return id, nil
+}
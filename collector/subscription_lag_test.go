@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+)
+
+func TestLagRecords(t *testing.T) {
+	const epoch = uint64(3) << 32
+	tests := []struct {
+		name    string
+		offset  hstream.SubscriptionOffset
+		tail    hstream.RecordId
+		appends streamAppends
+		lag     float64
+		ok      bool
+	}{
+		{
+			name:   "caught up",
+			offset: hstream.SubscriptionOffset{BatchId: epoch + 5, BatchIndex: 9},
+			tail:   hstream.RecordId{BatchId: epoch + 5, BatchIndex: 9},
+			ok:     true,
+		},
+		{
+			name:   "in the tail batch",
+			offset: hstream.SubscriptionOffset{BatchId: epoch + 5, BatchIndex: 2},
+			tail:   hstream.RecordId{BatchId: epoch + 5, BatchIndex: 9},
+			lag:    7,
+			ok:     true,
+		},
+		{
+			name:    "batches behind",
+			offset:  hstream.SubscriptionOffset{BatchId: epoch + 5, BatchIndex: 2},
+			tail:    hstream.RecordId{BatchId: epoch + 8, BatchIndex: 4},
+			appends: streamAppends{records: 1000, batches: 100},
+			// 7 records after the offset in batch 5, 10 in batch 6 and 7, and 5 in the tail batch
+			lag: 3*10 + 4 - 2,
+			ok:  true,
+		},
+		{
+			name:    "different epochs",
+			offset:  hstream.SubscriptionOffset{BatchId: epoch + 5},
+			tail:    hstream.RecordId{BatchId: epoch + 1<<32 + 1},
+			appends: streamAppends{records: 1000, batches: 100},
+		},
+		{
+			name:   "no appends counted",
+			offset: hstream.SubscriptionOffset{BatchId: epoch + 5},
+			tail:   hstream.RecordId{BatchId: epoch + 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lag, ok := lagRecords(tt.offset, tt.tail, tt.appends)
+			if lag != tt.lag || ok != tt.ok {
+				t.Errorf("lagRecords() = %v, %v, want %v, %v", lag, ok, tt.lag, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hstreamdb/hstream-exporter/registry"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "HSTREAM_EXPORTER_"
+
+// Config holds all the settings of the exporter. Every field can be set in the
+// yaml config file, and overridden by a HSTREAM_EXPORTER_<FIELD> environment
+// variable, e.g. HSTREAM_EXPORTER_ADDR overrides `addr`.
+type Config struct {
+	Addr       string `yaml:"addr"`
+	ListenAddr string `yaml:"listen_addr"`
+	// WebConfigFile is the path of the web config file which enables TLS and auth of the exporter http server.
+	WebConfigFile          string `yaml:"web_config_file"`
+	CaPath                 string `yaml:"ca_path"`
+	DisableExporterMetrics bool   `yaml:"disable_exporter_metrics"`
+	MaxRequest             int    `yaml:"max_request"`
+	// Timeout in seconds for each prometheus scrap request.
+	Timeout int `yaml:"timeout"`
+	// TimeoutOffset is the time in seconds subtracted from the scrape timeout, so that the
+	// partial results can be returned before the scrape times out.
+	TimeoutOffset float64 `yaml:"timeout_offset"`
+	LogLevel      string  `yaml:"log_level"`
+	// GetServerInfoDuration is the interval in seconds between two server info updates.
+	GetServerInfoDuration int    `yaml:"get_server_info_duration"`
+	User                  string `yaml:"user"`
+	Password              string `yaml:"password"`
+
+	// Clusters are scraped into the /metrics output with a cluster label, the top level
+	// addr and auth settings are used as a single cluster when it's empty.
+	Clusters []Cluster `yaml:"clusters"`
+
+	// ReadyDiscoveryIntervals is the number of server info update intervals after which the
+	// exporter becomes unready if the server info can't be updated.
+	ReadyDiscoveryIntervals int `yaml:"ready_discovery_intervals"`
+	// ShutdownTimeout is the time in seconds to wait for the in-flight scrapes when the exporter exits.
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+
+	// Modules are the auth settings used by the /probe endpoint, selected by the module parameter.
+	Modules map[string]Module `yaml:"modules"`
+	// ProbeCacheSize is the maximum number of cluster collectors kept by the /probe endpoint.
+	ProbeCacheSize int `yaml:"probe_cache_size"`
+	// ProbeIdleTimeout is the time in seconds after which an unused probe collector is closed.
+	ProbeIdleTimeout int `yaml:"probe_idle_timeout"`
+
+	// PollInterval is the interval in seconds to poll the clusters in background, the scrapes
+	// are served from the last polled snapshot. 0 disables the polling.
+	PollInterval int `yaml:"poll_interval"`
+
+	// Collectors enables or disables the collectors by name, e.g. `connector: false`.
+	Collectors map[string]bool `yaml:"collectors"`
+	// Summaries are the quantiles and the intervals of the latency summaries by name,
+	// e.g. stream_append_latency.
+	Summaries map[string]Summary `yaml:"summaries"`
+	// LatencyType is how the latency stats are exported, summary or histogram.
+	LatencyType string `yaml:"latency_type"`
+	// Metrics are added to the builtin metrics, a metric with the same subsystem and
+	// name replaces the builtin one.
+	Metrics []registry.Definition `yaml:"metrics"`
+	// Commands are the admin commands whose tables are exported as metrics.
+	Commands []registry.Command `yaml:"commands"`
+}
+
+// Summary holds the quantiles and the server side intervals of a latency summary.
+type Summary struct {
+	Quantiles []float64 `yaml:"quantiles"`
+	Intervals []string  `yaml:"intervals"`
+}
+
+// Module holds the settings used to connect a cluster probed by the /probe endpoint.
+type Module struct {
+	CaPath   string `yaml:"ca_path"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// Cluster holds the settings of a cluster scraped into the /metrics output.
+type Cluster struct {
+	Name   string `yaml:"name"`
+	Addr   string `yaml:"addr"`
+	Module `yaml:",inline"`
+}
+
+// Targets returns the clusters scraped into the /metrics output.
+func (c *Config) Targets() []Cluster {
+	if len(c.Clusters) == 0 {
+		m, _ := c.Module("")
+		return []Cluster{{Addr: c.Addr, Module: m}}
+	}
+	return c.Clusters
+}
+
+// Module returns the module with the given name, an empty name returns the
+// module built from the top level settings.
+func (c *Config) Module(name string) (Module, bool) {
+	if len(name) == 0 {
+		return Module{CaPath: c.CaPath, User: c.User, Password: c.Password}, true
+	}
+	m, ok := c.Modules[name]
+	return m, ok
+}
+
+// Load reads the config file at path on top of base, then applies the environment
+// variable overrides. An empty path skips the file and only applies the overrides.
+func Load(path string, base Config) (*Config, error) {
+	cfg := base
+	// the map is merged with the file content, copy it to keep base unchanged
+	cfg.Collectors = maps.Clone(base.Collectors)
+	if len(path) != 0 {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithMessage(err, "read config file error")
+		}
+		if err = yaml.Unmarshal(content, &cfg); err != nil {
+			return nil, errors.WithMessage(err, "parse config file error")
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Addr) == 0 {
+		return errors.New("addr can't be empty")
+	}
+	names := make(map[string]struct{}, len(c.Clusters))
+	for _, cluster := range c.Clusters {
+		if len(cluster.Name) == 0 || len(cluster.Addr) == 0 {
+			return errors.New("name and addr of the cluster can't be empty")
+		}
+		if _, ok := names[cluster.Name]; ok {
+			return fmt.Errorf("duplicated cluster name %q", cluster.Name)
+		}
+		names[cluster.Name] = struct{}{}
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout must be positive")
+	}
+	if c.TimeoutOffset < 0 || c.TimeoutOffset >= float64(c.Timeout) {
+		return errors.New("timeout_offset must be non-negative and less than timeout")
+	}
+	if c.GetServerInfoDuration <= 0 {
+		return errors.New("get_server_info_duration must be positive")
+	}
+	if c.ReadyDiscoveryIntervals <= 0 {
+		return errors.New("ready_discovery_intervals must be positive")
+	}
+	if c.ShutdownTimeout < 0 {
+		return errors.New("shutdown_timeout can't be negative")
+	}
+	if c.PollInterval < 0 {
+		return errors.New("poll_interval can't be negative")
+	}
+	if c.ProbeCacheSize <= 0 {
+		return errors.New("probe_cache_size must be positive")
+	}
+	if c.ProbeIdleTimeout <= 0 {
+		return errors.New("probe_idle_timeout must be positive")
+	}
+	return nil
+}
+
+// Hash returns a hash of the config content which can be exported as a metric value. The
+// passwords are cleared before hashing, so the hash doesn't change with them.
+func (c *Config) Hash() float64 {
+	cfg := *c
+	cfg.Password = ""
+	cfg.Modules = make(map[string]Module, len(c.Modules))
+	for name, m := range c.Modules {
+		m.Password = ""
+		cfg.Modules[name] = m
+	}
+	cfg.Clusters = make([]Cluster, len(c.Clusters))
+	for i, cluster := range c.Clusters {
+		cluster.Password = ""
+		cfg.Clusters[i] = cluster
+	}
+	content, _ := yaml.Marshal(&cfg)
+	sum := md5.Sum(content)
+	// only use the first 6 bytes so that the value can be represented by a float64 without loss
+	return float64(binary.BigEndian.Uint64(append([]byte{0, 0}, sum[:6]...)))
+}
+
+// applyEnv overrides the fields of cfg with the HSTREAM_EXPORTER_* environment variables.
+func applyEnv(cfg *Config) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if len(tag) == 0 || tag == "-" {
+			continue
+		}
+		name := envPrefix + strings.ToUpper(tag)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("invalid value of %s", name))
+			}
+			field.SetInt(int64(n))
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("invalid value of %s", name))
+			}
+			field.SetFloat(f)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("invalid value of %s", name))
+			}
+			field.SetBool(b)
+		}
+	}
+	return nil
+}
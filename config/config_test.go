@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testBase() Config {
+	return Config{
+		Addr:                    "hstream://127.0.0.1:6570",
+		ListenAddr:              ":9200",
+		Timeout:                 10,
+		GetServerInfoDuration:   30,
+		ReadyDiscoveryIntervals: 3,
+		ProbeCacheSize:          16,
+		ProbeIdleTimeout:        600,
+		Collectors:              map[string]bool{"stream": true},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		check   func(*Config) bool
+		wantErr bool
+	}{
+		{
+			name:  "base only",
+			check: func(c *Config) bool { return c.Addr == "hstream://127.0.0.1:6570" && c.Timeout == 10 },
+		},
+		{
+			name: "file overrides base",
+			file: "addr: hstream://a:6570\ntimeout: 20\ncollectors:\n  connector: false\n",
+			check: func(c *Config) bool {
+				return c.Addr == "hstream://a:6570" && c.Timeout == 20 && c.Collectors["stream"] && !c.Collectors["connector"]
+			},
+		},
+		{
+			name: "env overrides file",
+			file: "addr: hstream://a:6570\ntimeout: 20\n",
+			env: map[string]string{
+				"HSTREAM_EXPORTER_ADDR":                     "hstream://b:6570",
+				"HSTREAM_EXPORTER_TIMEOUT":                  "30",
+				"HSTREAM_EXPORTER_TIMEOUT_OFFSET":           "0.5",
+				"HSTREAM_EXPORTER_DISABLE_EXPORTER_METRICS": "true",
+			},
+			check: func(c *Config) bool {
+				return c.Addr == "hstream://b:6570" && c.Timeout == 30 && c.TimeoutOffset == 0.5 && c.DisableExporterMetrics
+			},
+		},
+		{
+			name:    "invalid int env",
+			env:     map[string]string{"HSTREAM_EXPORTER_TIMEOUT": "ten"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid float env",
+			env:     map[string]string{"HSTREAM_EXPORTER_TIMEOUT_OFFSET": "half"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid bool env",
+			env:     map[string]string{"HSTREAM_EXPORTER_DISABLE_EXPORTER_METRICS": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			file:    "timeout: [",
+			wantErr: true,
+		},
+		{
+			name:    "empty addr",
+			env:     map[string]string{"HSTREAM_EXPORTER_ADDR": ""},
+			wantErr: true,
+		},
+		{
+			name:    "timeout offset not less than timeout",
+			file:    "timeout: 5\ntimeout_offset: 5\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicated cluster",
+			file:    "clusters:\n  - {name: a, addr: hstream://a:6570}\n  - {name: a, addr: hstream://b:6570}\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if len(tt.file) != 0 {
+				path = filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			base := testBase()
+			cfg, err := Load(path, base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !tt.check(cfg) {
+				t.Errorf("unexpected config %+v", cfg)
+			}
+			if len(base.Collectors) != 1 {
+				t.Errorf("base collectors are changed: %v", base.Collectors)
+			}
+		})
+	}
+}
+
+func TestHashIgnoresPasswords(t *testing.T) {
+	cfg := testBase()
+	cfg.Modules = map[string]Module{"prod": {User: "admin", Password: "a"}}
+	cfg.Clusters = []Cluster{{Name: "a", Addr: "hstream://a:6570", Module: Module{Password: "a"}}}
+	cfg.Password = "a"
+	hash := cfg.Hash()
+
+	changed := cfg
+	changed.Password = "b"
+	changed.Modules = map[string]Module{"prod": {User: "admin", Password: "b"}}
+	changed.Clusters = []Cluster{{Name: "a", Addr: "hstream://a:6570", Module: Module{Password: "b"}}}
+	if changed.Hash() != hash {
+		t.Error("hash depends on the passwords")
+	}
+	if cfg.Password != "a" || cfg.Modules["prod"].Password != "a" || cfg.Clusters[0].Password != "a" {
+		t.Error("passwords of the config are cleared")
+	}
+
+	changed.Modules = map[string]Module{"prod": {User: "root", Password: "b"}}
+	if changed.Hash() == hash {
+		t.Error("hash doesn't change with the user")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hstreamdb/hstream-exporter/collector"
+	"github.com/hstreamdb/hstream-exporter/util"
+	"go.uber.org/zap"
+)
+
+type readiness struct {
+	Ready    bool               `json:"ready"`
+	Clusters []collector.Status `json:"clusters"`
+}
+
+// healthz reports the exporter process is alive.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readyz reports whether the exporter can scrape the HStream cluster, the exporter is
+// ready when any of the clusters is ready. The status of each target is returned as json.
+func (r *reloader) readyz(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	intervals := r.cfg.ReadyDiscoveryIntervals
+	collectors := r.collectors
+	r.lock.Unlock()
+
+	resp := readiness{Clusters: make([]collector.Status, 0, len(collectors))}
+	for _, c := range collectors {
+		status := c.Status(intervals)
+		resp.Ready = resp.Ready || status.Ready
+		resp.Clusters = append(resp.Clusters, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		util.Logger().Error("write readiness response error", zap.Error(err))
+	}
+}
@@ -1,70 +1,258 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/hstreamdb/hstream-exporter/collector"
+	"github.com/hstreamdb/hstream-exporter/config"
+	"github.com/hstreamdb/hstream-exporter/registry"
+	"github.com/hstreamdb/hstream-exporter/scraper"
 	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/hstreamdb/hstream-exporter/web"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
 var (
-	hServerAddr            = flag.String("addr", "hstream://127.0.0.1:6570", "HStream server addr")
+	configFile             = flag.String("config-file", "", "Path of the exporter config file, the flags are used as default values")
+	hServerAddr            = flag.String("addr", "hstream://127.0.0.1:6570", "HStream server addr, multiple comma-separated seeds are allowed")
 	listenAddr             = flag.String("listen-addr", ":9200", "Port on which to expose metrics")
+	webConfigFile          = flag.String("web-config-file", "", "Path of the web config file which enables TLS and authentication")
 	clientCaPath           = flag.String("ca-path", "", "Path of client ca file")
 	disableExporterMetrics = flag.Bool("disable-exporter-metrics", false, "Exclude metrics about the exporter itself")
 	maxScrapeRequest       = flag.Int("max-request", 0, "Maximum number of parallel scrape requests. Use 0 to disable.")
-	// TODO: the prometheus scrap timeout must greater than hstream rpc request timeout(default 5s), add a validation
-	timeout               = flag.Int("timeout", 10, "Time out in seconds for each prometheus scrap request.")
-	logLevel              = flag.String("log-level", "info", "Exporter log level")
-	getServerInfoDuration = flag.Int("get-server-info-duration", 30, "Get server info in second duration.")
-	user                  = flag.String("user", "", "User for authentication")
-	password              = flag.String("password", "", "Password for authentication")
+	timeout                = flag.Int("timeout", 10, "Time out in seconds for each prometheus scrap request.")
+	timeoutOffset          = flag.Float64("timeout-offset", 0.5, "Offset in seconds to subtract from the scrape timeout, so that the partial results can be returned before Prometheus gives up.")
+	logLevel               = flag.String("log-level", "info", "Exporter log level")
+	getServerInfoDuration  = flag.Int("get-server-info-duration", 30, "Get server info in second duration.")
+	user                   = flag.String("user", "", "User for authentication")
+	password               = flag.String("password", "", "Password for authentication")
+	readyIntervals         = flag.Int("ready-discovery-intervals", 3, "Report unready when get server info failed in the number of durations.")
+	shutdownTimeout        = flag.Int("shutdown-timeout", 30, "Time in seconds to wait for the in-flight scrapes when the exporter exits.")
+	probeCacheSize         = flag.Int("probe-cache-size", 32, "Maximum number of clusters cached by the probe endpoint.")
+	latencyType            = flag.String("latency-type", "summary", "Export the latency stats as summary or histogram")
+	pollInterval           = flag.Int("poll-interval", 0, "Poll the clusters in background every the seconds and serve the scrapes from the snapshot. Use 0 to disable.")
+	probeIdleTimeout       = flag.Int("probe-idle-timeout", 300, "Close the cached probe cluster after it's unused for the seconds.")
 )
 
-func newHandler(serverUrl string, includeExporterMetrics bool, maxRequests int, timeout int, caPath string, token string) (http.Handler, error) {
-	exporterMetricsRegistry := prometheus.NewRegistry()
-	if includeExporterMetrics {
-		exporterMetricsRegistry.MustRegister(
-			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
-			collectors.NewGoCollector(),
-		)
+// collectorFlags and noCollectorFlags are the --collector.<name> and --no-collector.<name>
+// flags, a collector is enabled only if it's not disabled by any of them.
+var collectorFlags, noCollectorFlags = func() (map[string]*bool, map[string]*bool) {
+	enabled, disabled := make(map[string]*bool), make(map[string]*bool)
+	for _, name := range collector.Names() {
+		enabled[name] = flag.Bool("collector."+name, collector.EnabledByDefault(name), fmt.Sprintf("Enable the %s collector", name))
+		disabled[name] = flag.Bool("no-collector."+name, false, fmt.Sprintf("Disable the %s collector", name))
+	}
+	return enabled, disabled
+}()
+
+func getCollectors() map[string]bool {
+	collectors := make(map[string]bool, len(collectorFlags))
+	for name, enabled := range collectorFlags {
+		collectors[name] = *enabled && !*noCollectorFlags[name]
+	}
+	return collectors
+}
+
+// metricsHandler serves the /metrics requests. Each request is scraped with a deadline
+// derived from the scrape timeout of Prometheus, and only the collectors named by the
+// collect[] parameters are scraped if there is any.
+type metricsHandler struct {
+	exporters []*collector.HStreamCollector
+	// metrics are the definitions the collect[] parameters are checked against
+	metrics []registry.Definition
+	// exporterMetricsRegistry is nil if the exporter metrics are not served
+	exporterMetricsRegistry *prometheus.Registry
+	opts                    promhttp.HandlerOpts
+	timeout                 time.Duration
+	timeoutOffset           time.Duration
+	// inFlight limits the number of parallel requests, it's nil if there is no limit
+	inFlight chan struct{}
+}
+
+func newMetricsHandler(cfg *config.Config, exporters []*collector.HStreamCollector, metrics []registry.Definition,
+	exporterMetricsRegistry *prometheus.Registry, maxRequest int) *metricsHandler {
+	m := &metricsHandler{
+		exporters:               exporters,
+		metrics:                 metrics,
+		exporterMetricsRegistry: exporterMetricsRegistry,
+		opts: promhttp.HandlerOpts{
+			ErrorLog:      util.NewPromErrLogger(),
+			ErrorHandling: promhttp.ContinueOnError,
+			Timeout:       time.Duration(cfg.Timeout) * time.Second,
+			Registry:      exporterMetricsRegistry,
+		},
+		timeout:       time.Duration(cfg.Timeout) * time.Second,
+		timeoutOffset: time.Duration(cfg.TimeoutOffset * float64(time.Second)),
+	}
+	if maxRequest > 0 {
+		m.inFlight = make(chan struct{}, maxRequest)
+	}
+	return m
+}
+
+// scrapeTimeout returns the deadline of the scrape request, which is the smaller one of
+// the timeout and the X-Prometheus-Scrape-Timeout-Seconds header, minus the offset.
+func (m *metricsHandler) scrapeTimeout(r *http.Request) time.Duration {
+	timeout := m.timeout
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); len(v) != 0 {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			util.Logger().Warn("invalid scrape timeout header", zap.String("value", v), zap.Error(err))
+		} else if t := time.Duration(seconds * float64(time.Second)); t > 0 && t < timeout {
+			timeout = t
+		}
+	}
+	if timeout > m.timeoutOffset {
+		timeout -= m.timeoutOffset
+	}
+	return timeout
+}
+
+// ServeHTTP implement http.Handler interface
+func (m *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filters := r.URL.Query()["collect[]"]
+	if err := collector.CheckNames(filters, m.metrics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if m.inFlight != nil {
+		select {
+		case m.inFlight <- struct{}{}:
+			defer func() { <-m.inFlight }()
+		default:
+			http.Error(w, fmt.Sprintf("Limit of concurrent requests reached (%d), try again later.", cap(m.inFlight)),
+				http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	timeout := m.scrapeTimeout(r)
+	util.Logger().Debug("collect metrics", zap.String("collectors", strings.Join(filters, ",")),
+		zap.String("timeout", timeout.String()))
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	reg := prometheus.NewRegistry()
+	for _, exporter := range m.exporters {
+		reg.MustRegister(exporter.ForRequest(ctx, filters))
+	}
+	gatherers := prometheus.Gatherers{reg}
+	if m.exporterMetricsRegistry != nil {
+		gatherers = prometheus.Gatherers{m.exporterMetricsRegistry, reg}
+	}
+	promhttp.HandlerFor(gatherers, m.opts).ServeHTTP(w, r)
+}
+
+func summaryOptions(cfg *config.Config) map[string]collector.SummaryOptions {
+	summaries := make(map[string]collector.SummaryOptions, len(cfg.Summaries))
+	for name, summary := range cfg.Summaries {
+		summaries[name] = collector.SummaryOptions{Quantiles: summary.Quantiles, Intervals: summary.Intervals}
 	}
+	return summaries
+}
+
+// scrapeTimeout returns the deadline of the scrapes which are not started by a scrape
+// request, e.g. the polls.
+func scrapeTimeout(cfg *config.Config) time.Duration {
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	return timeout - time.Duration(cfg.TimeoutOffset*float64(time.Second))
+}
 
-	registry := prometheus.NewRegistry()
-	exporter, err := collector.NewHStreamCollector(serverUrl, caPath, token, *getServerInfoDuration, registry)
+// metricDefinitions returns the builtin metrics merged with the metrics and the commands of the config.
+func metricDefinitions(cfg *config.Config) ([]registry.Definition, error) {
+	extra := append([]registry.Definition{}, cfg.Metrics...)
+	for _, command := range cfg.Commands {
+		extra = append(extra, command.Definitions()...)
+	}
+	defs, err := registry.Merge(extra)
 	if err != nil {
 		return nil, err
 	}
-	util.Logger().Info("create connection with hstream server", zap.String("url", serverUrl))
-	registry.MustRegister(exporter)
-	handler := promhttp.HandlerFor(
-		prometheus.Gatherers{exporterMetricsRegistry, registry},
-		promhttp.HandlerOpts{
-			ErrorLog:            util.NewPromErrLogger(),
-			ErrorHandling:       promhttp.ContinueOnError,
-			MaxRequestsInFlight: maxRequests,
-			Timeout:             time.Duration(timeout) * time.Second,
-			Registry:            exporterMetricsRegistry,
-		},
-	)
+	if err = collector.CheckMetrics(defs); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
 
-	if includeExporterMetrics {
+func newHandler(cfg *config.Config, exporterMetricsRegistry *prometheus.Registry) (http.Handler, []*collector.HStreamCollector, error) {
+	defs, err := metricDefinitions(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	collectors := make([]string, 0, len(cfg.Collectors))
+	for name := range cfg.Collectors {
+		collectors = append(collectors, name)
+	}
+	if err := collector.CheckNames(collectors, defs); err != nil {
+		return nil, nil, err
+	}
+	summaries := summaryOptions(cfg)
+	if err := collector.CheckSummaries(summaries, defs); err != nil {
+		return nil, nil, err
+	}
+	latency, err := scraper.ParseLatencyType(cfg.LatencyType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exporters := []*collector.HStreamCollector{}
+	for _, cluster := range cfg.Targets() {
+		var token = ""
+		if len(cluster.User) != 0 && len(cluster.Password) != 0 {
+			token = getToken(cluster.User, cluster.Password)
+		}
+
+		exporter, err := collector.NewHStreamCollector(collector.Options{
+			ServerUrl:          cluster.Addr,
+			CaPath:             cluster.CaPath,
+			Token:              token,
+			ServerInfoDuration: time.Duration(cfg.GetServerInfoDuration) * time.Second,
+			Cluster:            cluster.Name,
+			Collectors:         cfg.Collectors,
+			Summaries:          summaries,
+			LatencyType:        latency,
+			PollInterval:       time.Duration(cfg.PollInterval) * time.Second,
+			ScrapeTimeout:      scrapeTimeout(cfg),
+			Metrics:            defs,
+			MaxRequest:         cfg.MaxRequest,
+		})
+		if err != nil {
+			// one unreachable cluster should not stop the others from being scraped
+			util.Logger().Error("create collector error", zap.String("cluster", cluster.Name),
+				zap.String("url", cluster.Addr), zap.Error(err))
+			continue
+		}
+		util.Logger().Info("create connection with hstream server", zap.String("cluster", cluster.Name),
+			zap.String("url", cluster.Addr))
+		exporters = append(exporters, exporter)
+	}
+	if len(exporters) == 0 {
+		return nil, nil, errors.New("can't connect to any hstream cluster")
+	}
+
+	var handler http.Handler = newMetricsHandler(cfg, exporters, defs, exporterMetricsRegistry, cfg.MaxRequest)
+
+	if !cfg.DisableExporterMetrics {
 		// Note that we have to use h.exporterMetricsRegistry here to
 		// use the same promhttp metrics for all expositions.
 		handler = promhttp.InstrumentMetricHandler(
 			exporterMetricsRegistry, handler,
 		)
 	}
-	return handler, nil
+	return handler, exporters, nil
 }
 
 // updateLogLevel handle update log level request, e.g.: curl -X POST localhost:9200/log_level?debug
@@ -97,29 +285,92 @@ func main() {
 		os.Exit(1)
 	}
 
-	var token = ""
-	if len(*user) != 0 && len(*password) != 0 {
-		token = getToken(*user, *password)
+	base := config.Config{
+		Addr:                    *hServerAddr,
+		ListenAddr:              *listenAddr,
+		WebConfigFile:           *webConfigFile,
+		CaPath:                  *clientCaPath,
+		DisableExporterMetrics:  *disableExporterMetrics,
+		MaxRequest:              *maxScrapeRequest,
+		Timeout:                 *timeout,
+		TimeoutOffset:           *timeoutOffset,
+		LogLevel:                *logLevel,
+		GetServerInfoDuration:   *getServerInfoDuration,
+		User:                    *user,
+		Password:                *password,
+		ReadyDiscoveryIntervals: *readyIntervals,
+		ShutdownTimeout:         *shutdownTimeout,
+		ProbeCacheSize:          *probeCacheSize,
+		ProbeIdleTimeout:        *probeIdleTimeout,
+		PollInterval:            *pollInterval,
+		LatencyType:             *latencyType,
+		Collectors:              getCollectors(),
 	}
-	handler, err := newHandler(*hServerAddr, !(*disableExporterMetrics), *maxScrapeRequest, *timeout, *clientCaPath, token)
-	if err != nil {
+	// register the signals before anything else, or a signal received during the start
+	// kills the process without the graceful shutdown
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, os.Interrupt)
+
+	rl := newReloader(*configFile, base)
+	if err := rl.reload(); err != nil {
 		panic(fmt.Sprintf("create handler err: %s", err.Error()))
 	}
-	http.Handle("/metrics", handler)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			util.Logger().Info("receive SIGHUP, reload config")
+			if err := rl.reload(); err != nil {
+				util.Logger().Error("reload config error", zap.Error(err))
+			}
+		}
+	}()
+
+	http.Handle("/metrics", rl)
 	http.HandleFunc("/log_level", updateLogLevel)
+	http.HandleFunc("/-/reload", rl.handleReload)
+	http.Handle("/probe", rl.prober)
+	http.HandleFunc("/healthz", healthz)
+	http.HandleFunc("/readyz", rl.readyz)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>HStream Exporter</title></head>
 			<body>
 			<h1>HStream Exporter</h1>
 			<p><a href="` + "/metrics" + `">Metrics</a></p>
+			<p><a href="` + "/probe?target=hstream://127.0.0.1:6570" + `">Probe</a></p>
+			<p><a href="` + "/readyz" + `">Readiness</a></p>
 			</body>
 			</html>`))
 	})
 
-	server := &http.Server{Addr: *listenAddr}
-	util.Logger().Info("HStream Exporter start", zap.String("address", *listenAddr))
-	if err = server.ListenAndServe(); err != nil {
+	cfg := rl.config()
+	server := &http.Server{Addr: cfg.ListenAddr}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sig := <-term
+		// the config may be reloaded after start
+		timeout := time.Duration(rl.config().ShutdownTimeout) * time.Second
+		util.Logger().Info("receive signal, shutdown the exporter", zap.String("signal", sig.String()),
+			zap.String("timeout", timeout.String()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		// stop accepting new requests and wait for the in-flight scrapes
+		if err := server.Shutdown(ctx); err != nil {
+			util.Logger().Warn("shutdown http server error", zap.Error(err))
+		}
+		rl.Close(ctx)
+	}()
+
+	util.Logger().Info("HStream Exporter start", zap.String("address", cfg.ListenAddr))
+	if err := web.ListenAndServe(server, cfg.WebConfigFile); err != http.ErrServerClosed {
+		util.Logger().Error("http server exit", zap.Error(err))
 		os.Exit(1)
 	}
+	<-stopped
+	util.Logger().Info("HStream Exporter exit")
+	util.Sync()
 }
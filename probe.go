@@ -0,0 +1,222 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/collector"
+	"github.com/hstreamdb/hstream-exporter/config"
+	"github.com/hstreamdb/hstream-exporter/scraper"
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const probeEvictInterval = time.Minute
+
+type probeEntry struct {
+	key       string
+	collector *collector.HStreamCollector
+	handler   http.Handler
+	lastUsed  time.Time
+}
+
+// prober handles the /probe?target=hstream://host:6570&module=prod requests. A
+// collector is created for each target and module, and kept in a LRU cache so
+// that the following probes can reuse the connection and the server info loop.
+type prober struct {
+	stop chan struct{}
+
+	// The following fields are protected by the lock
+	lock    sync.Mutex
+	cfg     *config.Config
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+func newProber() *prober {
+	p := &prober{
+		stop:    make(chan struct{}),
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	go p.evictLoop()
+	return p
+}
+
+// update applies the new config, all the cached collectors are closed since
+// the module settings may be changed.
+func (p *prober) update(cfg *config.Config) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.cfg = cfg
+	for p.lru.Len() > 0 {
+		p.remove(p.lru.Back())
+	}
+}
+
+func (p *prober) evictLoop() {
+	ticker := time.NewTicker(probeEvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.lock.Lock()
+		if p.cfg != nil {
+			p.removeOlderThan(time.Now().Add(-time.Duration(p.cfg.ProbeIdleTimeout) * time.Second))
+		}
+		p.lock.Unlock()
+	}
+}
+
+// removeOlderThan closes the cached collectors which are unused since deadline,
+// the caller must hold the lock.
+func (p *prober) removeOlderThan(deadline time.Time) {
+	for e := p.lru.Back(); e != nil; {
+		entry := e.Value.(*probeEntry)
+		if entry.lastUsed.After(deadline) {
+			break
+		}
+		prev := e.Prev()
+		p.remove(e)
+		e = prev
+	}
+}
+
+// remove deletes the element from the cache, the collector is closed in background
+// after its in-flight scrapes are done. The caller must hold the lock.
+func (p *prober) remove(e *list.Element) {
+	entry := p.lru.Remove(e).(*probeEntry)
+	delete(p.entries, entry.key)
+	util.Logger().Info("close probe collector", zap.String("key", entry.key))
+	go func() {
+		if err := entry.collector.Close(); err != nil {
+			util.Logger().Warn("close probe collector error", zap.String("key", entry.key), zap.Error(err))
+		}
+	}()
+}
+
+// Close stops the evict loop and closes all the cached collectors, the in-flight
+// scrapes are waited until ctx is done.
+func (p *prober) Close(ctx context.Context) {
+	close(p.stop)
+	p.lock.Lock()
+	collectors := make([]*collector.HStreamCollector, 0, p.lru.Len())
+	for e := p.lru.Front(); e != nil; e = e.Next() {
+		collectors = append(collectors, e.Value.(*probeEntry).collector)
+	}
+	p.entries = make(map[string]*list.Element)
+	p.lru.Init()
+	p.lock.Unlock()
+
+	shutdownCollectors(ctx, collectors)
+}
+
+func (p *prober) get(target, module string) (http.Handler, error) {
+	key := module + "/" + target
+	p.lock.Lock()
+	cfg := p.cfg
+	if e, ok := p.entries[key]; ok {
+		entry := e.Value.(*probeEntry)
+		entry.lastUsed = time.Now()
+		p.lru.MoveToFront(e)
+		p.lock.Unlock()
+		return entry.handler, nil
+	}
+	p.lock.Unlock()
+
+	// the probe target is chosen by the caller, so the credentials of the top level settings
+	// are never sent to it, only the ones of the module named explicitly
+	m := config.Module{CaPath: cfg.CaPath}
+	if len(module) != 0 {
+		var ok bool
+		if m, ok = cfg.Module(module); !ok {
+			return nil, fmt.Errorf("unknown module %q", module)
+		}
+	}
+	var token = ""
+	if len(m.User) != 0 && len(m.Password) != 0 {
+		token = getToken(m.User, m.Password)
+	}
+
+	latency, err := scraper.ParseLatencyType(cfg.LatencyType)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := metricDefinitions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// create the collector without the lock, since it need to connect to the cluster
+	exporter, err := collector.NewHStreamCollector(collector.Options{
+		ServerUrl:          target,
+		CaPath:             m.CaPath,
+		Token:              token,
+		ServerInfoDuration: time.Duration(cfg.GetServerInfoDuration) * time.Second,
+		Collectors:         cfg.Collectors,
+		Summaries:          summaryOptions(cfg),
+		LatencyType:        latency,
+		ScrapeTimeout:      scrapeTimeout(cfg),
+		Metrics:            defs,
+		MaxRequest:         cfg.MaxRequest,
+	})
+	if err != nil {
+		return nil, err
+	}
+	handler := newMetricsHandler(cfg, []*collector.HStreamCollector{exporter}, defs, nil, 0)
+	util.Logger().Info("create probe collector", zap.String("target", target), zap.String("module", module))
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.cfg != cfg {
+		exporter.Close()
+		return nil, errors.New("config is reloaded during the probe")
+	}
+	if e, ok := p.entries[key]; ok {
+		// another probe created the collector concurrently
+		exporter.Close()
+		return e.Value.(*probeEntry).handler, nil
+	}
+	p.entries[key] = p.lru.PushFront(&probeEntry{
+		key:       key,
+		collector: exporter,
+		handler:   handler,
+		lastUsed:  time.Now(),
+	})
+	for p.lru.Len() > cfg.ProbeCacheSize {
+		p.remove(p.lru.Back())
+	}
+	return handler, nil
+}
+
+// ServeHTTP implement http.Handler interface
+func (p *prober) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if len(target) == 0 {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(target, "://") {
+		target = "hstream://" + target
+	}
+	module := r.URL.Query().Get("module")
+
+	handler, err := p.get(target, module)
+	if err != nil {
+		util.Logger().Error("probe target error", zap.String("target", target),
+			zap.String("module", module), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
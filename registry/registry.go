@@ -0,0 +1,234 @@
+package registry
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ValueType is the prometheus type of a metric.
+type ValueType string
+
+const (
+	Counter ValueType = "counter"
+	Gauge   ValueType = "gauge"
+	Summary ValueType = "summary"
+)
+
+// Source is where the value of a metric is got from.
+type Source string
+
+const (
+	// SourceStats is the stats rpc of the server.
+	SourceStats Source = "stats"
+	// SourceAdmin is the server_histogram admin command of the server.
+	SourceAdmin Source = "admin"
+	// SourceCommand is an arbitrary admin command of the server, see Command.
+	SourceCommand Source = "command"
+)
+
+// Definition declares a metric scraped from HStream, the metric is exported as
+// hstream_exporter_<subsystem>_<name>.
+type Definition struct {
+	Subsystem string    `yaml:"subsystem"`
+	Name      string    `yaml:"name"`
+	Help      string    `yaml:"help"`
+	Labels    []string  `yaml:"labels"`
+	Type      ValueType `yaml:"type"`
+	Source    Source    `yaml:"source"`
+	// Stat is the stat of the stats rpc, it's used by the stats source.
+	Stat string `yaml:"stat"`
+	// Histogram is the histogram of the server_histogram command, it's used by the admin source.
+	Histogram string `yaml:"histogram"`
+	// LabelColumns are the columns of the admin table used as the values of the labels.
+	LabelColumns []string `yaml:"label_columns"`
+	// CountStat is the stat of the stats rpc counting the samples of the histogram, it's
+	// optional for the admin source. The stat is grouped by the first label column.
+	CountStat string `yaml:"count_stat"`
+	// Command is the admin command of the command source.
+	Command string `yaml:"command"`
+	// ValueColumn is the column of the admin table used as the value, it's used by the command source.
+	ValueColumn string `yaml:"value_column"`
+	// MinInterval is the seconds the table of the command is reused for, it's used by
+	// the command source. The command is sent on every scrape if it's 0.
+	MinInterval int `yaml:"min_interval"`
+}
+
+// Command declares the metrics read from the table of an admin command, each row of
+// the table is exported as a sample of every metric, e.g.
+//
+//	name: stream_stats
+//	command: server stats stream appends -i 1min
+//	min_interval: 30
+//	metrics:
+//	  - name: appends_1min
+//	    help: Appends of the stream in the last minute.
+//	    type: gauge
+//	    labels: [stream]
+//	    label_columns: [stream_name]
+//	    value_column: appends_1min
+type Command struct {
+	// Name is the subsystem of the metrics, it's also the collector name.
+	Name        string          `yaml:"name"`
+	Command     string          `yaml:"command"`
+	MinInterval int             `yaml:"min_interval"`
+	Metrics     []CommandMetric `yaml:"metrics"`
+}
+
+// CommandMetric is a metric of a Command.
+type CommandMetric struct {
+	Name         string    `yaml:"name"`
+	Help         string    `yaml:"help"`
+	Type         ValueType `yaml:"type"`
+	Labels       []string  `yaml:"labels"`
+	LabelColumns []string  `yaml:"label_columns"`
+	ValueColumn  string    `yaml:"value_column"`
+}
+
+// Definitions returns the definitions of the metrics of the command.
+func (c Command) Definitions() []Definition {
+	defs := make([]Definition, 0, len(c.Metrics))
+	for _, m := range c.Metrics {
+		defs = append(defs, Definition{
+			Subsystem:    c.Name,
+			Name:         m.Name,
+			Help:         m.Help,
+			Labels:       m.Labels,
+			Type:         m.Type,
+			Source:       SourceCommand,
+			LabelColumns: m.LabelColumns,
+			Command:      c.Command,
+			ValueColumn:  m.ValueColumn,
+			MinInterval:  c.MinInterval,
+		})
+	}
+	return defs
+}
+
+//go:embed metrics.yaml
+var builtinContent []byte
+
+var builtin = func() []Definition {
+	var defs []Definition
+	if err := yaml.Unmarshal(builtinContent, &defs); err != nil {
+		panic(fmt.Sprintf("invalid builtin metrics: %s", err))
+	}
+	for _, def := range defs {
+		if err := def.validate(); err != nil {
+			panic(fmt.Sprintf("invalid builtin metric %s: %s", def.Key(), err))
+		}
+	}
+	return defs
+}()
+
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels are added by the exporter
+var reservedLabels = map[string]struct{}{"server_host": {}, "interval": {}, "cluster": {}}
+
+// Key identifies the metric, it's <subsystem>_<name>.
+func (d Definition) Key() string {
+	return d.Subsystem + "_" + d.Name
+}
+
+func (d Definition) validate() error {
+	if !nameRegexp.MatchString(d.Subsystem) || !nameRegexp.MatchString(d.Name) {
+		return errors.New("subsystem and name must be valid metric names")
+	}
+	for _, label := range d.Labels {
+		if !nameRegexp.MatchString(label) {
+			return fmt.Errorf("invalid label %q", label)
+		}
+		if _, ok := reservedLabels[label]; ok {
+			return fmt.Errorf("label %q is added by the exporter", label)
+		}
+	}
+	switch d.Source {
+	case SourceStats:
+		if d.Type != Counter && d.Type != Gauge {
+			return errors.New("the metric of the stats source must be a counter or gauge")
+		}
+		if len(d.Stat) == 0 {
+			return errors.New("stat of the stats source can't be empty")
+		}
+		if len(d.Labels) != 1 {
+			return errors.New("the metric of the stats source must have one label")
+		}
+	case SourceAdmin:
+		if d.Type != Summary {
+			return errors.New("the metric of the admin source must be a summary")
+		}
+		if len(d.Histogram) == 0 {
+			return errors.New("histogram of the admin source can't be empty")
+		}
+		if len(d.LabelColumns) != len(d.Labels) {
+			return errors.New("label_columns must have a column for each label")
+		}
+		if len(d.CountStat) != 0 && len(d.Labels) > 1 {
+			return errors.New("the metric with a count_stat can't have more than one label")
+		}
+	case SourceCommand:
+		if d.Type != Counter && d.Type != Gauge {
+			return errors.New("the metric of the command source must be a counter or gauge")
+		}
+		if len(d.Command) == 0 {
+			return errors.New("command of the command source can't be empty")
+		}
+		if len(d.ValueColumn) == 0 {
+			return errors.New("value_column of the command source can't be empty")
+		}
+		if len(d.LabelColumns) != len(d.Labels) {
+			return errors.New("label_columns must have a column for each label")
+		}
+		if d.MinInterval < 0 {
+			return errors.New("min_interval can't be negative")
+		}
+	default:
+		return fmt.Errorf("unknown source %q", d.Source)
+	}
+	return nil
+}
+
+// Builtin returns the metrics declared in metrics.yaml.
+func Builtin() []Definition {
+	return append([]Definition{}, builtin...)
+}
+
+// Merge returns the builtin metrics extended by extra, a metric in extra replaces
+// the builtin one with the same subsystem and name.
+func Merge(extra []Definition) ([]Definition, error) {
+	defs := Builtin()
+	index := make(map[string]int, len(defs))
+	for i, def := range defs {
+		index[def.Key()] = i
+	}
+	for _, def := range extra {
+		if err := def.validate(); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("invalid metric %s", def.Key()))
+		}
+		if i, ok := index[def.Key()]; ok {
+			defs[i] = def
+			continue
+		}
+		index[def.Key()] = len(defs)
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// Subsystems returns the subsystems of the metrics in the order they are declared.
+func Subsystems(defs []Definition) []string {
+	seen := make(map[string]struct{})
+	subsystems := []string{}
+	for _, def := range defs {
+		if _, ok := seen[def.Subsystem]; ok {
+			continue
+		}
+		seen[def.Subsystem] = struct{}{}
+		subsystems = append(subsystems, def.Subsystem)
+	}
+	return subsystems
+}
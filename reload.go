@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/collector"
+	"github.com/hstreamdb/hstream-exporter/config"
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.uber.org/zap"
+)
+
+// hstreamRPCTimeout is the default rpc request timeout of the hstream client.
+const hstreamRPCTimeout = 5 * time.Second
+
+var (
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hstream_exporter_config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful.",
+	})
+	configLastReloadSuccessTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hstream_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload.",
+	})
+	configHash = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hstream_exporter_config_hash",
+		Help: "Hash of the currently loaded configuration.",
+	})
+)
+
+// reloader serves the metrics request with the handler built from the latest
+// config, the handler and the HStreamCollector are rebuilt on each reload
+// without restarting the http server.
+type reloader struct {
+	configFile              string
+	base                    config.Config
+	exporterMetricsRegistry *prometheus.Registry
+	handler                 atomic.Value
+	prober                  *prober
+	// reloadLock serializes the reloads, the lock is only held to swap the handler so
+	// that the readers are not blocked by connecting to the clusters
+	reloadLock sync.Mutex
+
+	// The following fields are protected by the lock
+	lock       sync.Mutex
+	cfg        *config.Config
+	collectors []*collector.HStreamCollector
+	closed     bool
+}
+
+func newReloader(configFile string, base config.Config) *reloader {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(configLastReloadSuccessful, configLastReloadSuccessTime, configHash)
+	return &reloader{
+		configFile:              configFile,
+		base:                    base,
+		exporterMetricsRegistry: registry,
+		prober:                  newProber(),
+	}
+}
+
+func (r *reloader) config() *config.Config {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.cfg
+}
+
+// reload loads the config and replaces the metrics handler, the previous handler
+// is kept if any error occurs.
+func (r *reloader) reload() error {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	cfg, err := config.Load(r.configFile, r.base)
+	if err != nil {
+		configLastReloadSuccessful.Set(0)
+		return err
+	}
+
+	// only the reload changes cfg, which is serialized by the reloadLock
+	current := r.config()
+	if current == nil {
+		if !cfg.DisableExporterMetrics {
+			r.exporterMetricsRegistry.MustRegister(
+				collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+				collectors.NewGoCollector(),
+			)
+		}
+	} else {
+		if cfg.ListenAddr != current.ListenAddr {
+			util.Logger().Warn("listen addr can't be changed by reload, restart the exporter to apply it",
+				zap.String("current", current.ListenAddr), zap.String("new", cfg.ListenAddr))
+		}
+		if cfg.WebConfigFile != current.WebConfigFile {
+			util.Logger().Warn("web config file can't be changed by reload, restart the exporter to apply it",
+				zap.String("current", current.WebConfigFile), zap.String("new", cfg.WebConfigFile))
+		}
+		if cfg.DisableExporterMetrics != current.DisableExporterMetrics {
+			util.Logger().Warn("disable exporter metrics can't be changed by reload, restart the exporter to apply it")
+		}
+	}
+
+	if timeout := scrapeTimeout(cfg); timeout <= hstreamRPCTimeout {
+		util.Logger().Warn("scrape deadline is not greater than the hstream rpc timeout, the slow requests are abandoned with partial results",
+			zap.String("deadline", timeout.String()), zap.String("rpc timeout", hstreamRPCTimeout.String()))
+	}
+
+	if err = util.UpdateLogLevel(cfg.LogLevel); err != nil {
+		configLastReloadSuccessful.Set(0)
+		return err
+	}
+
+	handler, exporters, err := newHandler(cfg, r.exporterMetricsRegistry)
+	if err != nil {
+		configLastReloadSuccessful.Set(0)
+		return err
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		shutdownCollectors(ctx, exporters)
+		return errors.New("reloader is closed")
+	}
+	r.handler.Store(handler)
+	previous := r.collectors
+	r.collectors = exporters
+	r.cfg = cfg
+	r.lock.Unlock()
+	r.prober.update(cfg)
+
+	// wait for the in-flight scrapes of the previous collectors in background
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		shutdownCollectors(ctx, previous)
+	}()
+
+	configLastReloadSuccessful.Set(1)
+	configLastReloadSuccessTime.SetToCurrentTime()
+	configHash.Set(cfg.Hash())
+	util.Logger().Info("load config success", zap.String("file", r.configFile))
+	return nil
+}
+
+// Close closes all the collectors, the in-flight scrapes are waited until ctx is done.
+func (r *reloader) Close(ctx context.Context) {
+	r.lock.Lock()
+	collectors := r.collectors
+	r.collectors = nil
+	r.closed = true
+	r.lock.Unlock()
+	r.prober.Close(ctx)
+	shutdownCollectors(ctx, collectors)
+}
+
+// shutdownCollectors closes the collectors concurrently, the in-flight scrapes
+// are waited until ctx is done.
+func shutdownCollectors(ctx context.Context, collectors []*collector.HStreamCollector) {
+	wg := sync.WaitGroup{}
+	wg.Add(len(collectors))
+	for _, c := range collectors {
+		go func(c *collector.HStreamCollector) {
+			defer wg.Done()
+			if err := c.Shutdown(ctx); err != nil {
+				util.Logger().Warn("close collector error", zap.Error(err))
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// ServeHTTP implement http.Handler interface
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.Load().(http.Handler).ServeHTTP(w, req)
+}
+
+// handleReload handle reload config request, e.g.: curl -X POST localhost:9200/-/reload
+func (r *reloader) handleReload(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "reload only accept a post request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	util.Logger().Info("receive reload request")
+	if err := r.reload(); err != nil {
+		util.Logger().Error("reload config error", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,158 @@
+package scraper
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Capabilities are the supported stats of a server probed by the Scraper.
+type Capabilities struct {
+	// Unsupported are the stats and the histograms the server returns an error for.
+	Unsupported []string
+
+	unsupportedStats      map[hstream.StatType]struct{}
+	unsupportedHistograms map[string]struct{}
+}
+
+func newCapabilities() *Capabilities {
+	return &Capabilities{
+		unsupportedStats:      make(map[hstream.StatType]struct{}),
+		unsupportedHistograms: make(map[string]struct{}),
+	}
+}
+
+// Adapt returns the groups with the unsupported stats and histograms removed.
+func (c *Capabilities) Adapt(groups []Group) []Group {
+	if c == nil {
+		return groups
+	}
+	adapted := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		metrics := make([]Metrics, 0, len(g.Metrics))
+		for _, m := range g.Metrics {
+			if c.unsupported(m) {
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+		adapted = append(adapted, Group{Name: g.Name, Metrics: metrics})
+	}
+	return adapted
+}
+
+func (c *Capabilities) unsupported(m Metrics) bool {
+	switch {
+	case m.IsCommand():
+		return false
+	case m.IsSummary():
+		if _, ok := c.unsupportedHistograms[m.Histogram]; ok {
+			return true
+		}
+		// the histogram can't be counted without the count stat
+		_, ok := c.unsupportedStats[m.CountStat]
+		return ok && m.latencyType() == LatencyHistogram
+	default:
+		_, ok := c.unsupportedStats[m.Stat]
+		return ok
+	}
+}
+
+// Probe tries all the stats and histograms of the groups on the target, with the same requests
+// as the scrapes. An error is returned only if the target can't be
+// probed, e.g. it's down.
+func (s *Scraper) Probe(ctx context.Context, target string, groups []Group) (*Capabilities, error) {
+	c := newCapabilities()
+
+	stats := make(map[hstream.StatType]struct{})
+	histograms := make(map[string]Metrics)
+	for _, g := range c.Adapt(groups) {
+		for _, m := range g.Metrics {
+			switch {
+			case m.IsCommand():
+			case m.IsSummary():
+				// a histogram is probed with the HistogramQuantiles if any of the metrics wants them
+				if prev, ok := histograms[m.Histogram]; !ok || prev.latencyType() == LatencySummary {
+					histograms[m.Histogram] = m
+				}
+				if m.latencyType() == LatencyHistogram {
+					stats[m.CountStat] = struct{}{}
+				}
+			default:
+				stats[m.Stat] = struct{}{}
+			}
+		}
+	}
+
+	if len(stats) != 0 {
+		sts := make([]hstream.StatType, 0, len(stats))
+		for st := range stats {
+			sts = append(sts, st)
+		}
+		results, err := CallWithContext(ctx, s.limiter, func() ([]hstream.StatResult, error) {
+			return s.client.GetStatsRequest(target, sts)
+		})
+		if err != nil {
+			return nil, errors.WithMessage(err, "probe stats error")
+		}
+		for _, res := range results {
+			if stErr, ok := res.(hstream.StatError); ok {
+				c.unsupportedStats[stErr.Type] = struct{}{}
+				c.Unsupported = append(c.Unsupported, statName(stErr.Type))
+			}
+		}
+	}
+
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	var probeErr error
+	for _, m := range histograms {
+		wg.Add(1)
+		go func(metric Metrics) {
+			defer wg.Done()
+			cmd := getSummaryStatsCmd(metric, DefaultIntervals[0])
+			if metric.latencyType() == LatencyHistogram {
+				cmd = getHistogramQuantilesCmd(metric)
+			}
+			err := s.probeCommand(ctx, target, cmd)
+			if err == nil {
+				return
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			// the server is unsupported only if it answers the request with an error
+			if ctx.Err() != nil || Unreachable(err) {
+				probeErr = errors.WithMessage(err, "probe histogram error")
+				return
+			}
+			util.Logger().Debug("histogram is unsupported", zap.String("target", target),
+				zap.String("histogram", metric.Histogram), zap.Error(err))
+			c.unsupportedHistograms[metric.Histogram] = struct{}{}
+			c.Unsupported = append(c.Unsupported, metric.Histogram)
+		}(m)
+	}
+	wg.Wait()
+	if probeErr != nil {
+		return nil, probeErr
+	}
+	sort.Strings(c.Unsupported)
+	return c, nil
+}
+
+// probeCommand sends the admin command to the target, the response must be a table.
+func (s *Scraper) probeCommand(ctx context.Context, target, cmd string) error {
+	resp, err := CallWithContext(ctx, s.limiter, func() (string, error) {
+		return s.client.AdminRequestToServer(target, cmd)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = DecodeTable(resp)
+	return err
+}
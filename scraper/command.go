@@ -0,0 +1,159 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/registry"
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// commandTable is the table of an admin command cached for its MinInterval.
+type commandTable struct {
+	table   *Table
+	expires time.Time
+}
+
+// commandCache caches the tables of the admin commands by target and command.
+type commandCache struct {
+	lock   sync.Mutex
+	tables map[string]commandTable
+}
+
+func commandKey(target, command string) string {
+	return target + "\x00" + command
+}
+
+func (c *commandCache) get(target, command string) (*Table, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t, ok := c.tables[commandKey(target, command)]
+	if !ok || time.Now().After(t.expires) {
+		return nil, false
+	}
+	return t.table, true
+}
+
+func (c *commandCache) put(target, command string, table *Table, ttl time.Duration) {
+	now := time.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.tables == nil {
+		c.tables = make(map[string]commandTable)
+	}
+	// drop the expired tables, e.g. the tables of the removed targets
+	for key, t := range c.tables {
+		if now.After(t.expires) {
+			delete(c.tables, key)
+		}
+	}
+	c.tables[commandKey(target, command)] = commandTable{table: table, expires: now.Add(ttl)}
+}
+
+// scrapeCommands sends each admin command of the metrics once, and exports the rows of
+// the tables by the metrics of the command.
+func (s *Scraper) scrapeCommands(ctx context.Context, wg *sync.WaitGroup, target string, metrics []Metrics,
+	rec *recorder, ch chan<- prometheus.Metric) {
+	defer wg.Done()
+
+	commands := make(map[string][]Metrics)
+	order := []string{}
+	for _, m := range metrics {
+		if _, ok := commands[m.Command]; !ok {
+			order = append(order, m.Command)
+		}
+		commands[m.Command] = append(commands[m.Command], m)
+	}
+
+	wg1 := sync.WaitGroup{}
+	for _, cmd := range order {
+		wg1.Add(1)
+		go func(cmd string, metrics []Metrics) {
+			defer wg1.Done()
+			s.scrapeCommand(ctx, target, cmd, metrics, rec, ch)
+		}(cmd, commands[cmd])
+	}
+	wg1.Wait()
+}
+
+func (s *Scraper) scrapeCommand(ctx context.Context, target string, cmd string, metrics []Metrics,
+	rec *recorder, ch chan<- prometheus.Metric) {
+	table, ok := s.commands.get(target, cmd)
+	if !ok {
+		resp, err := CallWithContext(ctx, s.limiter, func() (string, error) {
+			return s.client.AdminRequestToServer(target, cmd)
+		})
+		if err != nil && ctx.Err() != nil {
+			util.Logger().Warn("admin request is abandoned", zap.String("cmd", cmd),
+				zap.String("url", target), zap.Error(ctx.Err()))
+			rec.interrupt(errors.WithMessage(ctx.Err(), "admin request error"))
+			return
+		}
+		if err != nil {
+			rec.fail(errors.WithMessage(err, "admin request error"))
+			util.Logger().Error("send admin request to HStream server error",
+				zap.String("cmd", cmd),
+				zap.String("url", target), zap.String("error", err.Error()))
+			return
+		}
+		if table, err = DecodeTable(resp); err != nil {
+			rec.fail(fmt.Errorf("%w: admin response: %w", ErrDecode, err))
+			util.Logger().Error("decode admin request error", zap.String("cmd", cmd),
+				zap.String("url", target), zap.String("error", err.Error()))
+			return
+		}
+		// the metrics of a command share the interval of the command
+		if ttl := metrics[0].MinInterval; ttl > 0 {
+			s.commands.put(target, cmd, table, ttl)
+		}
+	}
+
+	for _, m := range metrics {
+		if err := handleCommand(m, table, target, ch); err != nil {
+			rec.fail(fmt.Errorf("%w: command %s: %w", ErrDecode, m.Name, err))
+			util.Logger().Error("handle admin command error", zap.String("cmd", cmd),
+				zap.String("metric", m.Name), zap.String("target", target), zap.Error(err))
+			return
+		}
+	}
+	rec.succeed()
+}
+
+// handleCommand sends a sample for each row of the table, the values of the label columns
+// are used as the labels before server_host.
+func handleCommand(metric Metrics, table *Table, addr string, ch chan<- prometheus.Metric) error {
+	valueType := prometheus.CounterValue
+	if metric.ValueType == registry.Gauge {
+		valueType = prometheus.GaugeValue
+	}
+	// the rows with the same labels are reported for the same entity, only the last one is kept
+	samples := make(map[string]prometheus.Metric, len(table.Rows))
+	keys := make([]string, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		value, err := row.Float(metric.ValueColumn)
+		if err != nil {
+			return err
+		}
+		labels := make([]string, 0, len(metric.LabelColumns)+1)
+		for _, column := range metric.LabelColumns {
+			labels = append(labels, row.String(column))
+		}
+		labels = append(labels, addr)
+
+		key := strings.Join(labels, "\x00")
+		if _, ok := samples[key]; !ok {
+			keys = append(keys, key)
+		}
+		samples[key] = prometheus.MustNewConstMetric(metric.Metric, valueType, value, labels...)
+	}
+	for _, key := range keys {
+		ch <- samples[key]
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package scraper
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrDecode indicates the response of the server can't be decoded.
+	ErrDecode = errors.New("decode error")
+	// ErrStat indicates the server returns an error for a stat, e.g. the stat is unsupported.
+	ErrStat = errors.New("stat error")
+)
+
+// Unreachable returns whether the error means the target didn't answer the request. The
+// requests abandoned when the context is done are not counted, the target may be just slow.
+func Unreachable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch Reason(err) {
+	case "timeout", "unavailable":
+		return true
+	}
+	return false
+}
+
+// Reason classifies the scrape error, it's used as the reason label of the scrape errors.
+func Reason(err error) string {
+	switch {
+	case errors.Is(err, ErrDecode):
+		return "decode"
+	case errors.Is(err, ErrStat):
+		return "stat"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return "unknown"
+	}
+	switch st.Code() {
+	case codes.DeadlineExceeded:
+		return "timeout"
+	case codes.Unavailable:
+		return "unavailable"
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return "unauthenticated"
+	case codes.Canceled:
+		return "canceled"
+	case codes.Unimplemented:
+		return "unimplemented"
+	case codes.NotFound:
+		return "not_found"
+	case codes.ResourceExhausted:
+		return "resource_exhausted"
+	default:
+		return "internal"
+	}
+}
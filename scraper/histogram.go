@@ -0,0 +1,215 @@
+package scraper
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LatencyType decides how the latency stats are exported.
+type LatencyType string
+
+const (
+	// LatencySummary exports the quantiles computed by the server.
+	LatencySummary LatencyType = "summary"
+	// LatencyHistogram exports the latency stats with a count stat as histograms.
+	LatencyHistogram LatencyType = "histogram"
+)
+
+// ParseLatencyType returns the LatencyType of the name, an empty name is LatencySummary.
+func ParseLatencyType(name string) (LatencyType, error) {
+	switch t := LatencyType(name); t {
+	case "":
+		return LatencySummary, nil
+	case LatencySummary, LatencyHistogram:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown latency type %q", name)
+}
+
+var (
+	// HistogramQuantiles are the quantiles read from the server to build the histograms,
+	// the buckets are interpolated between them.
+	HistogramQuantiles = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 0.95, 0.99, 0.999}
+	// LatencyBuckets are the upper bounds of the histograms, in the unit of the server histograms.
+	LatencyBuckets = prometheus.ExponentialBuckets(1, 2, 20)
+)
+
+// latencyDist is the distribution of the samples of an interval given by the quantiles.
+type latencyDist struct {
+	// values are the values of the quantiles, from 0 at 0 to the highest quantile at 1
+	values    []float64
+	quantiles []float64
+}
+
+// newLatencyDist returns the distribution of the values of the quantiles. The samples
+// above the highest quantile are taken as the highest quantile.
+func newLatencyDist(quantiles, values []float64) latencyDist {
+	d := latencyDist{values: []float64{0}, quantiles: []float64{0}}
+	for i, q := range quantiles {
+		// the quantiles of the server may be rounded, keep the values increasing
+		v := math.Max(values[i], d.values[len(d.values)-1])
+		d.values = append(d.values, v)
+		d.quantiles = append(d.quantiles, q)
+	}
+	d.values = append(d.values, d.values[len(d.values)-1])
+	d.quantiles = append(d.quantiles, 1)
+	return d
+}
+
+// cdf returns the fraction of the samples not greater than x, interpolated linearly
+// between the quantiles.
+func (d latencyDist) cdf(x float64) float64 {
+	for i := 1; i < len(d.values); i++ {
+		if x < d.values[i] {
+			lo, hi := d.values[i-1], d.values[i]
+			return d.quantiles[i-1] + (d.quantiles[i]-d.quantiles[i-1])*(x-lo)/(hi-lo)
+		}
+	}
+	return 1
+}
+
+// mean returns the mean of the samples.
+func (d latencyDist) mean() float64 {
+	var mean float64
+	for i := 1; i < len(d.values); i++ {
+		mean += (d.quantiles[i] - d.quantiles[i-1]) * (d.values[i-1] + d.values[i]) / 2
+	}
+	return mean
+}
+
+// latencySeries is a histogram accumulated by the exporter for an entity of a server.
+type latencySeries struct {
+	labels []string
+	// lastCount is the count stat of the entity on the last scrape
+	lastCount int64
+	count     float64
+	sum       float64
+	// buckets are the cumulative counts of LatencyBuckets
+	buckets []float64
+}
+
+// observe adds the samples counted since the last scrape by the distribution d.
+func (s *latencySeries) observe(count int64, d latencyDist) {
+	n := count - s.lastCount
+	if n < 0 {
+		// the counter is reset by a restart of the server
+		n = count
+	}
+	s.lastCount = count
+	if n == 0 {
+		return
+	}
+	s.count += float64(n)
+	s.sum += float64(n) * d.mean()
+	for i, ub := range LatencyBuckets {
+		s.buckets[i] += float64(n) * d.cdf(ub)
+	}
+}
+
+func (s *latencySeries) metric(desc *prometheus.Desc) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(LatencyBuckets))
+	for i, ub := range LatencyBuckets {
+		buckets[ub] = uint64(math.Round(s.buckets[i]))
+	}
+	return prometheus.MustNewConstHistogram(desc, uint64(math.Round(s.count)), s.sum, buckets, s.labels...)
+}
+
+// histogramCache holds the histograms accumulated by metric and target.
+type histogramCache struct {
+	lock sync.Mutex
+	// series are the histograms of the entities by metric and target
+	series map[string]map[string]*latencySeries
+}
+
+// handleHistogram adds the samples counted by counts since the last scrape to the histograms
+// of metric on target, and sends all of them. The samples of an entity are distributed by
+// the quantiles of its row in table, and counted by the value of its first label column in
+// counts, or by the sum of counts if the metric has no labels. The histogram of an entity
+// is dropped once it's gone from counts.
+func (c *histogramCache) handleHistogram(metric Metrics, table *Table, counts map[string]int64, target string,
+	ch chan<- prometheus.Metric) error {
+	dists := make(map[string]latencyDist, len(table.Rows))
+	rows := make(map[string][]string, len(table.Rows))
+	for _, row := range table.Rows {
+		values := make([]float64, 0, len(HistogramQuantiles))
+		for _, q := range HistogramQuantiles {
+			value, err := row.Float(quantileColumn(q))
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+		labels := make([]string, 0, len(metric.LabelColumns)+1)
+		for _, column := range metric.LabelColumns {
+			labels = append(labels, row.String(column))
+		}
+		labels = append(labels, target)
+		key := strings.Join(labels, "\x00")
+		dists[key] = newLatencyDist(HistogramQuantiles, values)
+		rows[key] = labels
+	}
+
+	entities := counts
+	if len(metric.LabelColumns) == 0 {
+		var total int64
+		for _, v := range counts {
+			total += v
+		}
+		entities = map[string]int64{"": total}
+	}
+
+	metrics := c.update(metric, target, rows, dists, entities)
+	for _, m := range metrics {
+		ch <- m
+	}
+	return nil
+}
+
+// update observes the distributions of the rows and returns the histograms of metric on target.
+func (c *histogramCache) update(metric Metrics, target string, rows map[string][]string, dists map[string]latencyDist,
+	entities map[string]int64) []prometheus.Metric {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.series == nil {
+		c.series = make(map[string]map[string]*latencySeries)
+	}
+	seriesKey := commandKey(target, metric.Name)
+	series := c.series[seriesKey]
+	if series == nil {
+		series = make(map[string]*latencySeries)
+		c.series[seriesKey] = series
+	}
+
+	for key, labels := range rows {
+		if _, ok := entities[labels[0]]; !ok && len(metric.LabelColumns) != 0 {
+			continue
+		}
+		if _, ok := series[key]; !ok {
+			series[key] = &latencySeries{labels: labels, buckets: make([]float64, len(LatencyBuckets))}
+		}
+	}
+	metrics := make([]prometheus.Metric, 0, len(series))
+	for key, s := range series {
+		entity := ""
+		if len(metric.LabelColumns) != 0 {
+			entity = s.labels[0]
+		}
+		count, ok := entities[entity]
+		if !ok {
+			delete(series, key)
+			continue
+		}
+		if d, ok := dists[key]; ok {
+			s.observe(count, d)
+		} else {
+			// no sample of the entity in the interval
+			s.lastCount = count
+		}
+		metrics = append(metrics, s.metric(metric.HistogramDesc))
+	}
+	return metrics
+}
@@ -0,0 +1,150 @@
+package scraper
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// quantileRow returns the row of the entity with every HistogramQuantile at value, except
+// the ones in values.
+func quantileRow(stream string, value float64, values map[float64]float64) Row {
+	row := Row{"stream_name": stream}
+	for _, q := range HistogramQuantiles {
+		v, ok := values[q]
+		if !ok {
+			v = value
+		}
+		row[quantileColumn(q)] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return row
+}
+
+func TestHandleHistogram(t *testing.T) {
+	type scrape struct {
+		rows   []Row
+		counts map[string]int64
+	}
+	type histogram struct {
+		count   uint64
+		sum     float64
+		buckets map[float64]uint64
+	}
+	tests := []struct {
+		name    string
+		scrapes []scrape
+		// want are the histograms by stream after the last scrape
+		want map[string]histogram
+	}{
+		{
+			name: "first scrape counts all the samples",
+			scrapes: []scrape{
+				{rows: []Row{quantileRow("s1", 2, nil)}, counts: map[string]int64{"s1": 10}},
+			},
+			// 0.1 of the samples are in [0, 2], 0.9 are at 2
+			want: map[string]histogram{"s1": {count: 10, sum: 19, buckets: map[float64]uint64{1: 1, 2: 10}}},
+		},
+		{
+			name: "later scrapes add the increase of the count",
+			scrapes: []scrape{
+				{rows: []Row{quantileRow("s1", 2, nil)}, counts: map[string]int64{"s1": 10}},
+				{rows: []Row{quantileRow("s1", 8, nil)}, counts: map[string]int64{"s1": 14}},
+			},
+			want: map[string]histogram{"s1": {count: 14, sum: 19 + 4*7.6, buckets: map[float64]uint64{1: 1, 2: 10, 4: 10, 8: 14}}},
+		},
+		{
+			name: "counter reset",
+			scrapes: []scrape{
+				{rows: []Row{quantileRow("s1", 2, nil)}, counts: map[string]int64{"s1": 10}},
+				{rows: []Row{quantileRow("s1", 2, nil)}, counts: map[string]int64{"s1": 3}},
+			},
+			want: map[string]histogram{"s1": {count: 13, sum: 13 * 1.9, buckets: map[float64]uint64{1: 1, 2: 13}}},
+		},
+		{
+			name: "tail above the highest quantile",
+			scrapes: []scrape{
+				{rows: []Row{quantileRow("s1", 2, map[float64]float64{0.999: 16})}, counts: map[string]int64{"s1": 1000}},
+			},
+			// 0.99 at 2 and 0.999 at 16, the rest 0.001 is taken as 16
+			want: map[string]histogram{"s1": {count: 1000, sum: 1000 * (0.1*1 + 0.89*2 + 0.009*9 + 0.001*16),
+				buckets: map[float64]uint64{1: 50, 2: 990, 4: 991, 8: 994, 16: 1000}}},
+		},
+		{
+			name: "entity without samples keeps its histogram",
+			scrapes: []scrape{
+				{rows: []Row{quantileRow("s1", 2, nil)}, counts: map[string]int64{"s1": 10}},
+				{counts: map[string]int64{"s1": 12}},
+				{rows: []Row{quantileRow("s1", 2, nil)}, counts: map[string]int64{"s1": 13}},
+			},
+			want: map[string]histogram{"s1": {count: 11, sum: 11 * 1.9, buckets: map[float64]uint64{1: 1, 2: 11}}},
+		},
+		{
+			name: "entity without count is dropped",
+			scrapes: []scrape{
+				{rows: []Row{quantileRow("s1", 2, nil), quantileRow("s2", 2, nil)}, counts: map[string]int64{"s1": 10, "s2": 2}},
+				{rows: []Row{quantileRow("s1", 2, nil), quantileRow("s2", 2, nil)}, counts: map[string]int64{"s1": 10}},
+			},
+			want: map[string]histogram{"s1": {count: 10, sum: 19, buckets: map[float64]uint64{1: 1, 2: 10}}},
+		},
+	}
+
+	metric := Metrics{
+		Name:          "stream_append_latency",
+		LabelColumns:  []string{"stream_name"},
+		HistogramDesc: prometheus.NewDesc("test_latency", "Test latency.", []string{"stream", "server_host"}, nil),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &histogramCache{}
+			var got map[string]histogram
+			for _, sc := range tt.scrapes {
+				ch := make(chan prometheus.Metric, 16)
+				table := &Table{Rows: sc.rows}
+				if err := cache.handleHistogram(metric, table, sc.counts, "127.0.0.1:6570", ch); err != nil {
+					t.Fatal(err)
+				}
+				close(ch)
+
+				got = make(map[string]histogram)
+				for m := range ch {
+					out := &dto.Metric{}
+					if err := m.Write(out); err != nil {
+						t.Fatal(err)
+					}
+					h := histogram{count: out.Histogram.GetSampleCount(), sum: out.Histogram.GetSampleSum(),
+						buckets: make(map[float64]uint64)}
+					for _, b := range out.Histogram.Bucket {
+						h.buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+					}
+					got[out.Label[1].GetValue()] = h
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d histograms, want %d", len(got), len(tt.want))
+			}
+			for stream, want := range tt.want {
+				h, ok := got[stream]
+				if !ok {
+					t.Fatalf("no histogram of %s", stream)
+				}
+				if h.count != want.count || math.Abs(h.sum-want.sum) > 1e-6 {
+					t.Errorf("%s count, sum = %v, %v, want %v, %v", stream, h.count, h.sum, want.count, want.sum)
+				}
+				for _, ub := range LatencyBuckets {
+					// the buckets not listed hold all the samples
+					expected, ok := want.buckets[ub]
+					if !ok {
+						expected = want.count
+					}
+					if h.buckets[ub] != expected {
+						t.Errorf("%s bucket %v = %d, want %d", stream, ub, h.buckets[ub], expected)
+					}
+				}
+			}
+		})
+	}
+}
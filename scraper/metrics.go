@@ -0,0 +1,116 @@
+package scraper
+
+import (
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/registry"
+	"github.com/hstreamdb/hstreamdb-go/hstream"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics is a metric scraped from HStream, it's built from a registry.Definition.
+type Metrics struct {
+	// Name is the key of the definition, e.g. stream_append_in_bytes.
+	Name      string
+	Metric    *prometheus.Desc
+	ValueType registry.ValueType
+	// Stat is the stat of the stats rpc, it's nil for the summary stats.
+	Stat hstream.StatType
+	// Histogram is the histogram of the server_histogram command of the summary stats.
+	Histogram string
+	// LabelColumns are the columns of the admin table used as the labels of the summary
+	// stats, in the order of the variable labels of Metric before interval and server_host.
+	LabelColumns []string
+	// Quantiles and Intervals of the summary stats, the defaults are used if they are empty.
+	Quantiles []float64
+	Intervals []string
+	// LatencyType decides whether the summary stats are exported as summaries or histograms.
+	LatencyType LatencyType
+	// CountStat is the stat counting the samples of the Histogram, the summary stats without
+	// it are always exported as summaries.
+	CountStat hstream.StatType
+	// HistogramDesc is the desc of the summary stats exported as histograms, it has no interval label.
+	HistogramDesc *prometheus.Desc
+	// Command is the admin command of the metric read from an admin table, the rows of
+	// the table are exported by the LabelColumns and the ValueColumn.
+	Command     string
+	ValueColumn string
+	// MinInterval is how long the table of the Command is reused for.
+	MinInterval time.Duration
+}
+
+// IsCommand returns whether the metric is read from the table of an arbitrary admin command.
+func (m Metrics) IsCommand() bool {
+	return len(m.Command) != 0
+}
+
+// IsSummary returns whether the metric is a latency summary got by the admin command.
+func (m Metrics) IsSummary() bool {
+	return m.ValueType == registry.Summary
+}
+
+func (m Metrics) quantiles() []float64 {
+	if len(m.Quantiles) == 0 {
+		return DefaultQuantiles
+	}
+	return m.Quantiles
+}
+
+func (m Metrics) intervals() []string {
+	if len(m.Intervals) == 0 {
+		return DefaultIntervals
+	}
+	return m.Intervals
+}
+
+func (m Metrics) latencyType() LatencyType {
+	if len(m.LatencyType) == 0 || m.CountStat == nil {
+		return LatencySummary
+	}
+	return m.LatencyType
+}
+
+// statName returns the name of the stat in Stats, which is <category>_<name> of the server.
+func statName(stat hstream.StatType) string {
+	for name, st := range Stats {
+		if st == stat {
+			return name
+		}
+	}
+	return ""
+}
+
+// Stats are the stats of the stats rpc by the name used in the metric definitions.
+var Stats = map[string]hstream.StatType{
+	"stream_append_in_bytes":               hstream.StreamAppendInBytes,
+	"stream_append_in_records":             hstream.StreamAppendInRecords,
+	"stream_append_total":                  hstream.StreamAppendTotal,
+	"stream_append_failed":                 hstream.StreamAppendFailed,
+	"stream_read_in_bytes":                 hstream.StreamReadInBytes,
+	"stream_read_in_batches":               hstream.StreamReadInBatches,
+	"subscription_send_out_bytes":          hstream.SubSendOutBytes,
+	"subscription_send_out_records":        hstream.SubSendOutRecords,
+	"subscription_send_out_records_failed": hstream.SubSendOutRecordsFailed,
+	"subscription_received_acks":           hstream.ReceivedAcks,
+	"subscription_resend_records":          hstream.SubResendRecords,
+	"subscription_resend_records_failed":   hstream.SubResendRecordsFailed,
+	"subscription_request_messages":        hstream.SubRequestMessages,
+	"subscription_response_messages":       hstream.SubResponseMessages,
+	"subscription_checklist_size":          hstream.SubCheckListSize,
+	"connector_delivered_in_bytes":         hstream.ConnectorDeliveredInBytes,
+	"connector_delivered_in_records":       hstream.ConnectorDeliveredInRecords,
+	"connector_is_alive":                   hstream.ConnectorIsAlive,
+	"query_total_input_records":            hstream.QueryTotalInputRecords,
+	"query_total_output_records":           hstream.QueryTotalOutputRecords,
+	"query_total_execute_errors":           hstream.QueryTotalExcuteErrors,
+	"view_total_execute_queries":           hstream.ViewTotalExecuteQueries,
+	"cacheStore_append_in_bytes":           hstream.CacheStoreAppendInBytes,
+	"cacheStore_append_in_records":         hstream.CacheStoreAppendInRecords,
+	"cacheStore_append_total":              hstream.CacheStoreAppendTotal,
+	"cacheStore_append_failed":             hstream.CacheStoreAppendFailed,
+	"cacheStore_read_in_bytes":             hstream.CacheStoreReadInBytes,
+	"cacheStore_read_in_records":           hstream.CacheStoreReadInRecords,
+	"cacheStore_delivered_in_records":      hstream.CacheStoreDeliveredInRecords,
+	"cacheStore_delivered_total":           hstream.CacheStoreDeliveredTotal,
+	"cacheStore_delivered_failed":          hstream.CacheStoreDeliveredFailed,
+}
@@ -1,72 +1,230 @@
 package scraper
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"github.com/hstreamdb/hstream-exporter/registry"
 	"github.com/hstreamdb/hstream-exporter/util"
 	"github.com/hstreamdb/hstreamdb-go/hstream"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
-const (
-	getStatsCmd         = "server stats %s %s -i %s -p 0.5 -p 0.75 -p 0.90 -p 0.99"
-	summaryStatInterval = "1min"
+const getStatsCmd = "server stats %s %s -i %s"
+
+var (
+	// DefaultQuantiles are the quantiles of the summary stats without configured quantiles.
+	DefaultQuantiles = []float64{0.5, 0.75, 0.9, 0.99}
+	// DefaultIntervals are the intervals of the summary stats without configured intervals.
+	DefaultIntervals = []string{"1min"}
 )
 
-type Scrape interface {
-	Scrape(target string, metrics []Metrics, ch chan<- prometheus.Metric) (success int32, failed int32)
+// Group is a set of metrics scraped together, the Name is used as the collector
+// label of the scrape metrics.
+type Group struct {
+	Name    string
+	Metrics []Metrics
 }
 
-var summaryMetricSet = map[StatType]struct{}{
-	StreamAppendLatency:      {},
-	StreamReadLatency:        {},
-	CacheStoreAppendLatency:  {},
-	CacheStoreReadLatency:    {},
-	CheckStoreClusterLatency: {},
-	CheckMetaClusterLatency:  {},
+// Result is the scrape result of a Group on a target.
+type Result struct {
+	Group    string
+	Duration time.Duration
+	Success  int32
+	Failed   int32
+	// Interrupted is the number of requests abandoned when the context is done,
+	// they are also counted in Failed. The result is partial if it's not 0.
+	Interrupted int32
+	// Errors are all the errors occurred in the scrape, including the StatErrors
+	// returned by the server which don't fail the request.
+	Errors []error
+}
+
+type Scrape interface {
+	// Scrape sends the metrics of the groups on target to ch, the groups are scraped
+	// concurrently and a Result is returned for each of them. The requests not done
+	// when ctx is done are abandoned, nothing is sent to ch after Scrape returns.
+	Scrape(ctx context.Context, target string, groups []Group, ch chan<- prometheus.Metric) []Result
+	// Probe returns the capabilities of target for the metrics of the groups.
+	Probe(ctx context.Context, target string, groups []Group) (*Capabilities, error)
 }
 
 type Scraper struct {
-	client *hstream.HStreamClient
+	client     *hstream.HStreamClient
+	limiter    *Limiter
+	commands   commandCache
+	histograms histogramCache
 }
 
-func NewScraper(client *hstream.HStreamClient) Scrape {
-	return &Scraper{client: client}
+// NewScraper returns a Scrape with the client, the calls of the client are bounded by limiter.
+func NewScraper(client *hstream.HStreamClient, limiter *Limiter) Scrape {
+	return &Scraper{client: client, limiter: limiter}
 }
 
-func (s *Scraper) Scrape(target string, metrics []Metrics, ch chan<- prometheus.Metric) (int32, int32) {
-	batchedMetrics := make(map[hstream.StatType]*prometheus.Desc, len(metrics))
-	summaryMetrics := make(map[StatType]*prometheus.Desc)
-	for _, m := range metrics {
-		if _, ok := summaryMetricSet[m.Type]; !ok {
-			batchedMetrics[m.Type.ToHStreamStatType()] = m.Metric
+func (s *Scraper) Scrape(ctx context.Context, target string, groups []Group, ch chan<- prometheus.Metric) []Result {
+	results := make([]Result, len(groups))
+	// only fetch connector alive state once
+	connectorAliveStatOnce := atomic.Bool{}
+	connectorAliveStatOnce.Store(false)
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(groups))
+	for i, g := range groups {
+		go func(i int, g Group) {
+			defer wg.Done()
+			results[i] = s.scrapeGroup(ctx, target, g, &connectorAliveStatOnce, ch)
+		}(i, g)
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *Scraper) scrapeGroup(ctx context.Context, target string, group Group, connectorAliveStatOnce *atomic.Bool, ch chan<- prometheus.Metric) Result {
+	start := time.Now()
+	batchedMetrics := make(map[hstream.StatType]Metrics, len(group.Metrics))
+	summaryMetrics := []Metrics{}
+	commandMetrics := []Metrics{}
+	for _, m := range group.Metrics {
+		if m.IsCommand() {
+			commandMetrics = append(commandMetrics, m)
+		} else if m.IsSummary() {
+			summaryMetrics = append(summaryMetrics, m)
 		} else {
-			summaryMetrics[m.Type] = m.Metric
+			batchedMetrics[m.Stat] = m
 		}
 	}
 
-	successScrapeRequest := atomic.Int32{}
-	failedScrapeRequest := atomic.Int32{}
+	rec := &recorder{}
 	wg := sync.WaitGroup{}
-	wg.Add(2)
-	// only fetch connector alive state once
-	connectorAliveStatOnce := atomic.Bool{}
-	connectorAliveStatOnce.Store(false)
-	s.batchScrape(&wg, target, batchedMetrics, &successScrapeRequest, &failedScrapeRequest, &connectorAliveStatOnce, ch)
-	s.scrapeSummary(&wg, target, summaryMetrics, &successScrapeRequest, &failedScrapeRequest, ch)
+	if len(batchedMetrics) != 0 {
+		wg.Add(1)
+		s.batchScrape(ctx, &wg, target, batchedMetrics, rec, connectorAliveStatOnce, ch)
+	}
+	if len(summaryMetrics) != 0 {
+		wg.Add(1)
+		s.scrapeSummary(ctx, &wg, target, summaryMetrics, rec, ch)
+	}
+	if len(commandMetrics) != 0 {
+		wg.Add(1)
+		go s.scrapeCommands(ctx, &wg, target, commandMetrics, rec, ch)
+	}
 	wg.Wait()
 
-	return successScrapeRequest.Load(), failedScrapeRequest.Load()
+	return Result{
+		Group:       group.Name,
+		Duration:    time.Since(start),
+		Success:     rec.success,
+		Failed:      rec.failed,
+		Interrupted: rec.interrupted,
+		Errors:      rec.errs,
+	}
+}
+
+// recorder records the results of the requests in a scrape.
+type recorder struct {
+	lock        sync.Mutex
+	success     int32
+	failed      int32
+	interrupted int32
+	errs        []error
+}
+
+func (r *recorder) succeed() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.success++
+}
+
+func (r *recorder) fail(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.failed++
+	r.errs = append(r.errs, err)
+}
+
+// interrupt records the request abandoned since the context is done.
+func (r *recorder) interrupt(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.failed++
+	r.interrupted++
+	r.errs = append(r.errs, err)
+}
+
+// warn records the error which doesn't fail the request.
+func (r *recorder) warn(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.errs = append(r.errs, err)
 }
 
-func (s *Scraper) batchScrape(wg *sync.WaitGroup, target string, metrics map[hstream.StatType]*prometheus.Desc,
-	success *atomic.Int32, failed *atomic.Int32, connectorAliveStatOnce *atomic.Bool, ch chan<- prometheus.Metric) {
+// DefaultMaxCalls is the limit of the running calls of a Limiter when the scrape requests
+// are not limited.
+const DefaultMaxCalls = 256
+
+// CallsPerRequest is the limit of the running calls of a Limiter for each parallel scrape request.
+const CallsPerRequest = 64
+
+// Limiter bounds the calls of the hstream client running at the same time, including the
+// abandoned ones, so that a slow cluster can't pile up goroutines. Each cluster has its own
+// Limiter, a hung cluster only blocks its own calls.
+type Limiter struct {
+	// slots holds a slot for each running call
+	slots chan struct{}
+}
+
+// NewLimiter returns a Limiter of the calls for maxRequest parallel scrape requests, it
+// allows DefaultMaxCalls calls if maxRequest is not positive.
+func NewLimiter(maxRequest int) *Limiter {
+	n := DefaultMaxCalls
+	if maxRequest > 0 {
+		n = maxRequest * CallsPerRequest
+	}
+	return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// CallWithContext returns the result of f, or ctx.Err() if ctx is done before f returns.
+// The hstream client doesn't accept a context, so the call is abandoned rather than
+// cancelled: it keeps running in background until the rpc timeout of the client, but
+// its result is dropped. The call waits for a slot of l, the abandoned call keeps its
+// slot until it returns.
+func CallWithContext[T any](ctx context.Context, l *Limiter, f func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() { <-l.slots }()
+		value, err := f()
+		done <- result{value: value, err: err}
+	}()
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+func (s *Scraper) batchScrape(ctx context.Context, wg *sync.WaitGroup, target string, metrics map[hstream.StatType]Metrics,
+	rec *recorder, connectorAliveStatOnce *atomic.Bool, ch chan<- prometheus.Metric) {
 	go func() {
 		defer wg.Done()
 		mc := make([]hstream.StatType, 0, len(metrics))
@@ -77,11 +235,18 @@ func (s *Scraper) batchScrape(wg *sync.WaitGroup, target string, metrics map[hst
 			mc = append(mc, k)
 		}
 
-		statsResult, err := s.client.GetStatsRequest(target, mc)
+		statsResult, err := CallWithContext(ctx, s.limiter, func() ([]hstream.StatResult, error) {
+			return s.client.GetStatsRequest(target, mc)
+		})
+		if err != nil && ctx.Err() != nil {
+			util.Logger().Warn("batch stats request is abandoned", zap.String("target", target), zap.Error(ctx.Err()))
+			rec.interrupt(errors.WithMessage(ctx.Err(), "get stats error"))
+			return
+		}
 		if err != nil {
 			util.Logger().Error("send batch stats request to HStream server error",
 				zap.String("target", target), zap.String("error", err.Error()))
-			failed.Add(1)
+			rec.fail(errors.WithMessage(err, "get stats error"))
 			return
 		}
 
@@ -90,15 +255,13 @@ func (s *Scraper) batchScrape(wg *sync.WaitGroup, target string, metrics map[hst
 			switch st.(type) {
 			case hstream.StatValue:
 				stat := st.(hstream.StatValue)
+				m := metrics[stat.Type]
+				valueType := prometheus.CounterValue
+				if m.ValueType == registry.Gauge {
+					valueType = prometheus.GaugeValue
+				}
 				for k, v := range stat.Value {
-					switch stat.Type {
-					case hstream.SubCheckListSize, hstream.ConnectorIsAlive,
-						hstream.CacheStoreAppendTotal, hstream.CacheStoreAppendFailed,
-						hstream.CacheStoreDeliveredTotal, hstream.CacheStoreDeliveredFailed:
-						ch <- prometheus.MustNewConstMetric(metrics[stat.Type], prometheus.GaugeValue, float64(v), k, addr)
-					default:
-						ch <- prometheus.MustNewConstMetric(metrics[stat.Type], prometheus.CounterValue, float64(v), k, addr)
-					}
+					ch <- prometheus.MustNewConstMetric(m.Metric, valueType, float64(v), k, addr)
 					util.Logger().Debug(fmt.Sprintf("scrape counter [%s]", stat.Type),
 						zap.String("host", addr),
 						zap.String("metrics", fmt.Sprintf("%s: %v", k, v)),
@@ -110,136 +273,195 @@ func (s *Scraper) batchScrape(wg *sync.WaitGroup, target string, metrics map[hst
 					zap.String("stat name", stErr.Type.String()),
 					zap.String("target", target),
 					zap.String("message", stErr.Message))
+				rec.warn(fmt.Errorf("%w: %s: %s", ErrStat, stErr.Type, stErr.Message))
 			}
 		}
-		success.Add(1)
+		rec.succeed()
 	}()
 }
 
-func (s *Scraper) scrapeSummary(wg *sync.WaitGroup, target string, metrics map[StatType]*prometheus.Desc,
-	success *atomic.Int32, failed *atomic.Int32, ch chan<- prometheus.Metric) {
+func (s *Scraper) scrapeSummary(ctx context.Context, wg *sync.WaitGroup, target string, metrics []Metrics,
+	rec *recorder, ch chan<- prometheus.Metric) {
 	defer wg.Done()
 
 	wg1 := sync.WaitGroup{}
-	wg1.Add(len(metrics))
-
-	for m := range metrics {
-		go func(addr string, metric StatType) {
-			defer wg1.Done()
-			cmd := getSummaryStatsCmd(metric)
-			resp, err := s.client.AdminRequestToServer(addr, cmd)
-			if err != nil {
-				failed.Add(1)
-				util.Logger().Error("send admin request to HStream server error",
-					zap.String("cmd", cmd),
-					zap.String("url", addr), zap.String("error", err.Error()))
-				return
-			}
-
-			table, err := parseResponse(resp)
-			if err != nil {
-				failed.Add(1)
-				util.Logger().Error("decode admin request error", zap.String("cmd", cmd),
-					zap.String("url", addr), zap.String("error", err.Error()))
-				return
-			}
-			table["server_host"] = addr
-			if err = handleSummary(metrics[metric], metric, table, ch); err != nil {
-				failed.Add(1)
-				util.Logger().Error("handle summary stats error", zap.String("stat", metric.String()),
-					zap.String("target", addr), zap.Error(err))
-				return
-			}
-			success.Add(1)
-		}(target, m)
+	for _, m := range metrics {
+		if m.latencyType() == LatencyHistogram {
+			wg1.Add(1)
+			go func(metric Metrics) {
+				defer wg1.Done()
+				s.scrapeHistogram(ctx, target, metric, rec, ch)
+			}(m)
+			continue
+		}
+		for _, interval := range m.intervals() {
+			wg1.Add(1)
+			go func(addr string, metric Metrics, interval string) {
+				defer wg1.Done()
+				s.scrapeSummaryInterval(ctx, addr, metric, interval, rec, ch)
+			}(target, m, interval)
+		}
 	}
 	wg1.Wait()
 }
 
-func getSummaryStatsCmd(stat StatType) string {
-	switch stat {
-	case StreamAppendLatency:
-		return fmt.Sprintf(getStatsCmd, "server_histogram", "append_latency", summaryStatInterval)
-	case StreamReadLatency:
-		return fmt.Sprintf(getStatsCmd, "server_histogram", "read_latency", summaryStatInterval)
-	case CacheStoreAppendLatency:
-		return fmt.Sprintf(getStatsCmd, "server_histogram", "append_cache_store_latency", summaryStatInterval)
-	case CacheStoreReadLatency:
-		return fmt.Sprintf(getStatsCmd, "server_histogram", "read_cache_store_latency", summaryStatInterval)
-	case CheckStoreClusterLatency:
-		return fmt.Sprintf(getStatsCmd, "server_histogram", "check_store_cluster_healthy_latency", summaryStatInterval)
-	case CheckMetaClusterLatency:
-		return fmt.Sprintf(getStatsCmd, "server_histogram", "check_meta_cluster_healthy_latency", summaryStatInterval)
+func (s *Scraper) scrapeSummaryInterval(ctx context.Context, addr string, metric Metrics, interval string,
+	rec *recorder, ch chan<- prometheus.Metric) {
+	cmd := getSummaryStatsCmd(metric, interval)
+	resp, err := CallWithContext(ctx, s.limiter, func() (string, error) {
+		return s.client.AdminRequestToServer(addr, cmd)
+	})
+	if err != nil && ctx.Err() != nil {
+		util.Logger().Warn("admin request is abandoned", zap.String("cmd", cmd),
+			zap.String("url", addr), zap.Error(ctx.Err()))
+		rec.interrupt(errors.WithMessage(ctx.Err(), "admin request error"))
+		return
+	}
+	if err != nil {
+		rec.fail(errors.WithMessage(err, "admin request error"))
+		util.Logger().Error("send admin request to HStream server error",
+			zap.String("cmd", cmd),
+			zap.String("url", addr), zap.String("error", err.Error()))
+		return
 	}
-	util.Logger().Error("unsupported summary stat", zap.String("stat", stat.String()))
-	return ""
-}
 
-type respTable struct {
-	Headers []string   `json:"headers"`
-	Rows    [][]string `json:"rows"`
+	table, err := DecodeTable(resp)
+	if err != nil {
+		rec.fail(fmt.Errorf("%w: admin response: %w", ErrDecode, err))
+		util.Logger().Error("decode admin request error", zap.String("cmd", cmd),
+			zap.String("url", addr), zap.String("error", err.Error()))
+		return
+	}
+	if err = handleSummary(metric, interval, table, addr, ch); err != nil {
+		rec.fail(fmt.Errorf("%w: summary stats: %w", ErrDecode, err))
+		util.Logger().Error("handle summary stats error", zap.String("stat", metric.Name),
+			zap.String("target", addr), zap.Error(err))
+		return
+	}
+	rec.succeed()
 }
 
-// serverStatsInfo indicates the stats scraped from the server
-// e.g.
-// | server_host | stream_name | appends_1min | <- headers
-// |   server1   |     s1      |    1829      | <- rows[0]
-type serverStatsInfo = map[string]string
+// scrapeHistogram reads the count stat and the quantiles of the first interval of the
+// histogram, and sends the histograms accumulated by them.
+func (s *Scraper) scrapeHistogram(ctx context.Context, addr string, metric Metrics, rec *recorder,
+	ch chan<- prometheus.Metric) {
+	counts, err := s.getCounts(ctx, addr, metric.CountStat)
+	if err == nil {
+		var table *Table
+		if table, err = s.getHistogramTable(ctx, addr, metric); err == nil {
+			err = s.histograms.handleHistogram(metric, table, counts, addr, ch)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		util.Logger().Warn("histogram request is abandoned", zap.String("histogram", metric.Histogram),
+			zap.String("url", addr), zap.Error(ctx.Err()))
+		rec.interrupt(errors.WithMessage(ctx.Err(), "histogram request error"))
+		return
+	}
+	if err != nil {
+		rec.fail(errors.WithMessage(err, "histogram request error"))
+		util.Logger().Error("scrape histogram error", zap.String("stat", metric.Name),
+			zap.String("target", addr), zap.Error(err))
+		return
+	}
+	rec.succeed()
+}
 
-func parseResponse(resp string) (serverStatsInfo, error) {
-	var jsonObj map[string]json.RawMessage
-	if err := json.Unmarshal([]byte(resp), &jsonObj); err != nil {
+// getCounts returns the values of the count stat by the entities.
+func (s *Scraper) getCounts(ctx context.Context, addr string, stat hstream.StatType) (map[string]int64, error) {
+	results, err := CallWithContext(ctx, s.limiter, func() ([]hstream.StatResult, error) {
+		return s.client.GetStatsRequest(addr, []hstream.StatType{stat})
+	})
+	if err != nil {
 		return nil, err
 	}
-
-	var table respTable
-	if content, ok := jsonObj["content"]; ok {
-		if err := json.Unmarshal(content, &table); err != nil {
-			return nil, err
+	for _, res := range results {
+		switch res := res.(type) {
+		case hstream.StatValue:
+			return res.Value, nil
+		case hstream.StatError:
+			return nil, fmt.Errorf("%w: %s: %s", ErrStat, res.Type, res.Message)
 		}
-	} else {
-		return nil, errors.New("no content fields in admin response")
 	}
+	return nil, fmt.Errorf("%w: no result of %s", ErrStat, stat)
+}
 
-	header := table.Headers
-	mp := make(serverStatsInfo)
-	for _, rows := range table.Rows {
-		for i := 0; i < len(rows); i++ {
-			mp[header[i]] = rows[i]
-		}
+func (s *Scraper) getHistogramTable(ctx context.Context, addr string, metric Metrics) (*Table, error) {
+	cmd := getHistogramQuantilesCmd(metric)
+	resp, err := CallWithContext(ctx, s.limiter, func() (string, error) {
+		return s.client.AdminRequestToServer(addr, cmd)
+	})
+	if err != nil {
+		return nil, err
 	}
+	table, err := DecodeTable(resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: admin response: %w", ErrDecode, err)
+	}
+	return table, nil
+}
 
-	return mp, nil
+func getSummaryStatsCmd(metric Metrics, interval string) string {
+	return getQuantilesCmd(metric, interval, metric.quantiles())
 }
 
-func handleSummary(metric *prometheus.Desc, metricType StatType, mp map[string]string, ch chan<- prometheus.Metric) error {
-	var err error
-	parse := func(input string) float64 {
-		if err != nil {
-			return 0
-		}
-		value, e := strconv.ParseFloat(input, 64)
-		if e != nil {
-			err = e
-			return 0
-		}
-		return value
-	}
+// getHistogramQuantilesCmd returns the command reading the HistogramQuantiles of the first interval.
+func getHistogramQuantilesCmd(metric Metrics) string {
+	return getQuantilesCmd(metric, metric.intervals()[0], HistogramQuantiles)
+}
 
-	p50 := parse(mp["p50"])
-	p90 := parse(mp["p90"])
-	p99 := parse(mp["p99"])
-	if err != nil {
-		return err
+func getQuantilesCmd(metric Metrics, interval string, quantiles []float64) string {
+	cmd := getHistogramCmd(metric, interval)
+	for _, q := range quantiles {
+		cmd += " -p " + strconv.FormatFloat(q, 'f', -1, 64)
 	}
+	return cmd
+}
+
+func getHistogramCmd(metric Metrics, interval string) string {
+	return fmt.Sprintf(getStatsCmd, "server_histogram", metric.Histogram, interval)
+}
 
-	util.Logger().Debug(fmt.Sprintf("scrape summary [%s]", metricType),
-		zap.String("host", mp["server_host"]),
-		zap.String("metrics", fmt.Sprintf("%+v", mp)),
-	)
+// quantileColumn returns the column of the quantile in the admin table, e.g. p99 for 0.99.
+func quantileColumn(q float64) string {
+	return "p" + strconv.FormatFloat(math.Round(q*1e6)/1e4, 'f', -1, 64)
+}
+
+// handleSummary sends a summary for each row of the table, the values of the label
+// columns of the metric are used as the labels before interval and server_host.
+func handleSummary(metric Metrics, interval string, table *Table, addr string, ch chan<- prometheus.Metric) error {
+	quantiles := metric.quantiles()
+	// the rows with the same labels are reported by the server for the same entity, only the last one is kept
+	summaries := make(map[string]prometheus.Metric, len(table.Rows))
+	keys := make([]string, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		values := make(map[float64]float64, len(quantiles))
+		for _, q := range quantiles {
+			value, err := row.Float(quantileColumn(q))
+			if err != nil {
+				return err
+			}
+			values[q] = value
+		}
 
-	ch <- prometheus.MustNewConstSummary(metric, 0, 0,
-		map[float64]float64{0.5: p50, 0.90: p90, 0.99: p99}, mp["server_host"])
+		labels := make([]string, 0, len(metric.LabelColumns)+2)
+		for _, column := range metric.LabelColumns {
+			labels = append(labels, row.String(column))
+		}
+		labels = append(labels, interval, addr)
+		util.Logger().Debug(fmt.Sprintf("scrape summary [%s]", metric.Name),
+			zap.String("host", addr),
+			zap.String("metrics", fmt.Sprintf("%+v", row)),
+		)
 
+		key := strings.Join(labels, "\x00")
+		if _, ok := summaries[key]; !ok {
+			keys = append(keys, key)
+		}
+		summaries[key] = prometheus.MustNewConstSummary(metric.Metric, 0, 0, values, labels...)
+	}
+	for _, key := range keys {
+		ch <- summaries[key]
+	}
 	return nil
 }
@@ -0,0 +1,75 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Table is the table returned by the admin commands
+// e.g.
+// | server_host | stream_name | appends_1min | <- Headers
+// |   server1   |     s1      |    1829      | <- Rows[0]
+// |   server1   |     s2      |    267       | <- Rows[1]
+type Table struct {
+	Headers []string
+	Rows    []Row
+}
+
+// Row is a row of the admin table, the values are indexed by the column names.
+type Row map[string]string
+
+// String returns the value of the column, it's empty if the column doesn't exist.
+func (r Row) String(column string) string {
+	return r[column]
+}
+
+// Float parses the value of the column as a float.
+func (r Row) Float(column string) (float64, error) {
+	value, ok := r[column]
+	if !ok {
+		return 0, fmt.Errorf("no %s column", column)
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.WithMessage(err, fmt.Sprintf("invalid %s column", column))
+	}
+	return f, nil
+}
+
+type respTable struct {
+	Headers []string   `json:"headers"`
+	Rows    [][]string `json:"rows"`
+}
+
+// DecodeTable decodes the json response of an admin command into a Table.
+func DecodeTable(resp string) (*Table, error) {
+	var jsonObj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(resp), &jsonObj); err != nil {
+		return nil, err
+	}
+
+	var content respTable
+	if raw, ok := jsonObj["content"]; ok {
+		if err := json.Unmarshal(raw, &content); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.New("no content fields in admin response")
+	}
+
+	table := &Table{Headers: content.Headers, Rows: make([]Row, 0, len(content.Rows))}
+	for i, values := range content.Rows {
+		if len(values) != len(content.Headers) {
+			return nil, fmt.Errorf("row %d has %d columns, but there are %d headers", i, len(values), len(content.Headers))
+		}
+		row := make(Row, len(values))
+		for j, value := range values {
+			row[content.Headers[j]] = value
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
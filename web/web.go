@@ -0,0 +1,346 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hstreamdb/hstream-exporter/util"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the web config of the exporter http server. The format is compatible
+// with the web config file of the prometheus exporter-toolkit, with bearer_tokens
+// as an extension.
+type Config struct {
+	TLSConfig    TLSConfig         `yaml:"tls_server_config"`
+	Users        map[string]string `yaml:"basic_auth_users"`
+	BearerTokens []string          `yaml:"bearer_tokens"`
+}
+
+type TLSConfig struct {
+	CertFile   string     `yaml:"cert_file"`
+	KeyFile    string     `yaml:"key_file"`
+	ClientAuth string     `yaml:"client_auth_type"`
+	ClientCAs  string     `yaml:"client_ca_file"`
+	MinVersion TLSVersion `yaml:"min_version"`
+	MaxVersion TLSVersion `yaml:"max_version"`
+}
+
+type TLSVersion uint16
+
+var tlsVersions = map[string]TLSVersion{
+	"TLS13": tls.VersionTLS13,
+	"TLS12": tls.VersionTLS12,
+	"TLS11": tls.VersionTLS11,
+	"TLS10": tls.VersionTLS10,
+}
+
+func (v *TLSVersion) UnmarshalYAML(value *yaml.Node) error {
+	version, ok := tlsVersions[value.Value]
+	if !ok {
+		return fmt.Errorf("unknown TLS version: %s", value.Value)
+	}
+	*v = version
+	return nil
+}
+
+func (v TLSVersion) MarshalYAML() (interface{}, error) {
+	for name, version := range tlsVersions {
+		if version == v {
+			return name, nil
+		}
+	}
+	return fmt.Sprintf("%d", v), nil
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+func (c *Config) validate() error {
+	tc := c.TLSConfig
+	if (len(tc.CertFile) == 0) != (len(tc.KeyFile) == 0) {
+		return errors.New("cert_file and key_file must be set together")
+	}
+	clientAuth, ok := clientAuthTypes[tc.ClientAuth]
+	if !ok {
+		return fmt.Errorf("invalid client_auth_type: %s", tc.ClientAuth)
+	}
+	if len(tc.ClientCAs) != 0 && clientAuth == tls.NoClientCert {
+		return errors.New("client_ca_file is set but client_auth_type is NoClientCert")
+	}
+	if len(tc.CertFile) == 0 && (len(tc.ClientCAs) != 0 || clientAuth != tls.NoClientCert) {
+		return errors.New("client certificate verification needs cert_file and key_file")
+	}
+	for _, token := range c.BearerTokens {
+		if len(token) == 0 {
+			return errors.New("bearer token can't be empty")
+		}
+	}
+	return nil
+}
+
+func loadConfig(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "read web config file error")
+	}
+	cfg := &Config{}
+	if err = yaml.Unmarshal(content, cfg); err != nil {
+		return nil, errors.WithMessage(err, "parse web config file error")
+	}
+	if err = cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// fileVersion identifies the content of the files by their modification time and size.
+func fileVersion(paths ...string) (string, error) {
+	var b strings.Builder
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return b.String(), nil
+}
+
+// webServer reloads the web config and the certificates when they change on disk.
+type webServer struct {
+	path string
+
+	// The following fields are protected by the lock
+	lock        sync.Mutex
+	version     string
+	cfg         *Config
+	certVersion string
+	tlsConfig   *tls.Config
+	authCache   map[[sha256.Size]byte]struct{}
+}
+
+// config returns the latest web config, the previous one is kept if the
+// config file becomes invalid.
+func (s *webServer) config() *Config {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	version, err := fileVersion(s.path)
+	if err != nil || version == s.version {
+		return s.cfg
+	}
+	cfg, err := loadConfig(s.path)
+	if err != nil {
+		util.Logger().Error("reload web config error, keep using the previous one", zap.Error(err))
+		return s.cfg
+	}
+	util.Logger().Info("reload web config", zap.String("path", s.path))
+	s.version = version
+	s.cfg = cfg
+	s.authCache = make(map[[sha256.Size]byte]struct{})
+	return cfg
+}
+
+// getTLSConfig builds the tls config for each new connection, so that the
+// changed certificates are used without restarting the server.
+func (s *webServer) getTLSConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	cfg := s.config()
+	tc := cfg.TLSConfig
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	version, err := fileVersion(tc.CertFile, tc.KeyFile, tc.ClientCAs)
+	if err != nil {
+		if s.tlsConfig != nil {
+			util.Logger().Error("stat certificate error, keep using the previous one", zap.Error(err))
+			return s.tlsConfig, nil
+		}
+		return nil, err
+	}
+	version += fmt.Sprintf("%s:%d:%d", tc.ClientAuth, tc.MinVersion, tc.MaxVersion)
+	if s.tlsConfig != nil && version == s.certVersion {
+		return s.tlsConfig, nil
+	}
+
+	tlsConfig, err := newTLSConfig(&tc)
+	if err != nil {
+		if s.tlsConfig != nil {
+			util.Logger().Error("load certificate error, keep using the previous one", zap.Error(err))
+			return s.tlsConfig, nil
+		}
+		return nil, err
+	}
+	util.Logger().Info("load certificate", zap.String("cert", tc.CertFile))
+	s.certVersion = version
+	s.tlsConfig = tlsConfig
+	return tlsConfig, nil
+}
+
+// nextProtos are the ALPN protocols of the server, the config for the client replaces
+// the one set up by the http server, so it must announce h2 itself.
+var nextProtos = []string{"h2", "http/1.1"}
+
+func newTLSConfig(tc *TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+	if err != nil {
+		return nil, errors.WithMessage(err, "load server certificate error")
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   nextProtos,
+		ClientAuth:   clientAuthTypes[tc.ClientAuth],
+		MinVersion:   uint16(tc.MinVersion),
+		MaxVersion:   uint16(tc.MaxVersion),
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	if len(tc.ClientCAs) != 0 {
+		content, err := os.ReadFile(tc.ClientCAs)
+		if err != nil {
+			return nil, errors.WithMessage(err, "read client ca file error")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errors.New("no valid certificate in client ca file")
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// checkBasicAuth verifies the password with the bcrypt hash, the valid passwords are
+// cached since bcrypt is designed to be slow.
+func (s *webServer) checkBasicAuth(cfg *Config, user, password string) bool {
+	hashed, ok := cfg.Users[user]
+	if !ok {
+		return false
+	}
+	key := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + hashed))
+	s.lock.Lock()
+	_, ok = s.authCache[key]
+	s.lock.Unlock()
+	if ok {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) != nil {
+		return false
+	}
+	s.lock.Lock()
+	s.authCache[key] = struct{}{}
+	s.lock.Unlock()
+	return true
+}
+
+func checkBearerToken(cfg *Config, token string) bool {
+	for _, t := range cfg.BearerTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *webServer) authHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.config()
+		if len(cfg.Users) == 0 && len(cfg.BearerTokens) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if user, password, ok := r.BasicAuth(); ok && s.checkBasicAuth(cfg, user, password) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok && checkBearerToken(cfg, token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(cfg.Users) != 0 {
+			w.Header().Set("WWW-Authenticate", "Basic")
+		} else {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// ListenAndServe starts the server with the TLS and auth settings in the web config
+// file, it's the same as server.ListenAndServe if the path is empty. Whether to use
+// TLS is decided at start, the other settings are reloaded when the file changes.
+func ListenAndServe(server *http.Server, path string) error {
+	if len(path) == 0 {
+		return server.ListenAndServe()
+	}
+
+	version, err := fileVersion(path)
+	if err != nil {
+		return errors.WithMessage(err, "read web config file error")
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	s := &webServer{
+		path:      path,
+		version:   version,
+		cfg:       cfg,
+		authCache: make(map[[sha256.Size]byte]struct{}),
+	}
+
+	handler := server.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = s.authHandler(handler)
+
+	if len(cfg.TLSConfig.CertFile) == 0 {
+		util.Logger().Info("TLS is disabled", zap.String("web config", path))
+		return server.ListenAndServe()
+	}
+	if _, err = s.getTLSConfig(nil); err != nil {
+		return err
+	}
+	// ServeTLS before go 1.24 requires a certificate in the base config, and the config for
+	// the client must keep the ALPN protocols set up by the server, or h2 is not negotiated
+	base := &tls.Config{NextProtos: nextProtos}
+	base.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		tlsConfig, err := s.getTLSConfig(hello)
+		if err != nil {
+			return nil, err
+		}
+		return &tlsConfig.Certificates[0], nil
+	}
+	base.GetConfigForClient = s.getTLSConfig
+	server.TLSConfig = base
+	if server.ReadHeaderTimeout == 0 {
+		server.ReadHeaderTimeout = 10 * time.Second
+	}
+	util.Logger().Info("TLS is enabled", zap.String("web config", path))
+	return server.ListenAndServeTLS("", "")
+}